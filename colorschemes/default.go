@@ -19,6 +19,10 @@ var Default = Colorscheme{
 
 	DiskBar: 7,
 
+	Dim:   8,
+	Alert: 1,
+	New:   2,
+
 	TempLow:  2,
 	TempHigh: 1,
 }
@@ -19,6 +19,10 @@ var DefaultDark = Colorscheme{
 
 	DiskBar: 252,
 
+	Dim:   248,
+	Alert: 1,
+	New:   2,
+
 	TempLow:  2,
 	TempHigh: 1,
 }
@@ -19,6 +19,10 @@ var Monokai = Colorscheme{
 
 	DiskBar: 102,
 
+	Dim:   241,
+	Alert: 197,
+	New:   148,
+
 	TempLow:  70,
 	TempHigh: 208,
 }
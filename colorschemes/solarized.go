@@ -19,6 +19,10 @@ var Solarized = Colorscheme{
 
 	DiskBar: 245,
 
+	Dim:   240,
+	Alert: 160,
+	New:   37,
+
 	TempLow:  64,
 	TempHigh: 160,
 }
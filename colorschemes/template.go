@@ -40,6 +40,13 @@ type Colorscheme struct {
 
 	DiskBar int
 
+	// colors table rows for devices that are offline
+	Dim int
+	// colors table rows for devices with new errors
+	Alert int
+	// colors table rows for processes that just started
+	New int
+
 	// colors the temperature number a different color if it's over a certain threshold
 	TempLow  int
 	TempHigh int
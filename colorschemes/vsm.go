@@ -19,6 +19,10 @@ var VSM = Colorscheme{
 
 	DiskBar: 250,
 
+	Dim:   248,
+	Alert: 1,
+	New:   2,
+
 	TempLow:  2,
 	TempHigh: 1,
 }
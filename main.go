@@ -1,16 +1,19 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	ui "github.com/benmcclelland/termui"
 	"github.com/benmcclelland/vsmtop/colorschemes"
+	"github.com/benmcclelland/vsmtop/utils"
 	w "github.com/benmcclelland/vsmtop/widgets"
 )
 
@@ -22,6 +25,16 @@ var (
 	helpToggled = make(chan bool, 1)
 	helpVisible = false
 
+	signalToggled = make(chan bool, 1)
+	signalVisible = false
+	prioToggled   = make(chan bool, 1)
+	prioVisible   = false
+	readOnly      = false
+
+	// used to render the process detail view when it opens, closes or refreshes
+	detailRefreshed = make(chan bool, 1)
+	detailVisible   = false
+
 	wg sync.WaitGroup
 	// used to render the proc widget whenever a key is pressed for it
 	procKeyPressed = make(chan bool, 1)
@@ -31,6 +44,8 @@ var (
 	tapeKeyPressed = make(chan bool, 1)
 	// used to render the net widget whenever a key is pressed for it
 	netKeyPressed = make(chan bool, 1)
+	// used to render the events widget whenever a key is pressed for it
+	eventsKeyPressed = make(chan bool, 1)
 	// used to render cpu and mem when zoom has changed
 	zoomed = make(chan bool, 1)
 
@@ -40,17 +55,228 @@ var (
 	zoom         = 7
 	zoomInterval = 3
 
-	cpu  *w.CPU
-	mem  *w.Mem
-	proc *w.Proc
-	net  *w.Net
-	disk *w.Disk
-	tape *w.Tape
+	cpu     *w.CPU
+	mem     *w.Mem
+	proc    *w.Proc
+	net     *w.Net
+	disk    *w.Disk
+	fs      *w.FsUsage
+	tape    *w.Tape
+	chgr    *w.Changer
+	fc      *w.FC
+	events  *w.Events
+	daemons *w.Daemons
+
+	// widgets that take the keyboard in turn when tab is pressed
+	focusables []focusable
+	focus      = 0
+
+	help       *w.HelpMenu
+	signalMenu *w.SignalMenu
+	prioMenu   *w.PrioMenu
+	detail     *w.ProcDetailView
+
+	procFilters []utils.ProcFilter
+	// daemons that should always be running, besides the ones the mcf needs
+	daemonNames []string
+)
 
-	focus = 0
+type focusable struct {
+	table      *ui.Table
+	foreGround func()
+	backGround func()
+	keyPressed chan bool
+}
 
-	help *w.HelpMenu
-)
+func setupFocus() {
+	focusables = []focusable{
+		{proc.Table, proc.ForeGround, proc.BackGround, procKeyPressed},
+		{disk.Table, disk.ForeGround, disk.BackGround, diskKeyPressed},
+		{tape.Table, tape.ForeGround, tape.BackGround, tapeKeyPressed},
+		{events.Table, events.ForeGround, events.BackGround, eventsKeyPressed},
+	}
+
+	events.Jump = func(target, dev string) {
+		switch target {
+		case w.TargetDisk:
+			if disk.Select(dev) {
+				setFocus(1)
+			}
+		case w.TargetTape:
+			if tape.Select(dev) {
+				setFocus(2)
+			}
+		}
+	}
+}
+
+// openSignalMenu takes the keyboard away from the focused widget until a
+// signal is sent or the menu is cancelled
+func openSignalMenu(procs []utils.ProcHandle, target string) {
+	signalMenu.Open(procs, target)
+	focusables[focus].backGround()
+	signalVisible = true
+
+	ui.On("<up>", "k", func(e ui.Event) {
+		signalMenu.Up()
+		signalToggled <- true
+	})
+	ui.On("<down>", "j", func(e ui.Event) {
+		signalMenu.Down()
+		signalToggled <- true
+	})
+	ui.On("<enter>", func(e ui.Event) {
+		proc.SetStatus(signalMenu.Send())
+		closeSignalMenu()
+	})
+	ui.On("<escape>", func(e ui.Event) {
+		closeSignalMenu()
+	})
+}
+
+func closeSignalMenu() {
+	ui.Off("<up>", "k", "<down>", "j", "<enter>")
+	ui.On("<escape>", hideHelp)
+	focusables[focus].foreGround()
+	signalVisible = false
+	signalToggled <- true
+}
+
+func openPrioMenu(procs []utils.ProcHandle, target string, nice, ioClass, ioLevel int) {
+	prioMenu.Open(procs, target, nice, ioClass, ioLevel)
+	focusables[focus].backGround()
+	prioVisible = true
+
+	ui.On("<up>", "k", func(e ui.Event) {
+		prioMenu.Up()
+		prioToggled <- true
+	})
+	ui.On("<down>", "j", func(e ui.Event) {
+		prioMenu.Down()
+		prioToggled <- true
+	})
+	ui.On("<left>", "<right>", func(e ui.Event) {
+		if e.Key == "<left>" {
+			prioMenu.Change(-1)
+		} else {
+			prioMenu.Change(1)
+		}
+		prioToggled <- true
+	})
+	ui.On("<enter>", func(e ui.Event) {
+		proc.SetStatus(prioMenu.Apply())
+		proc.PriorityChanged()
+		closePrioMenu()
+	})
+	ui.On("<escape>", func(e ui.Event) {
+		closePrioMenu()
+	})
+}
+
+func closePrioMenu() {
+	ui.Off("<up>", "k", "<down>", "j", "<left>", "<right>", "<enter>")
+	ui.On("<escape>", hideHelp)
+	focusables[focus].foreGround()
+	prioVisible = false
+	prioToggled <- true
+}
+
+// openDetail shows the detail view of a process until escape is pressed
+func openDetail(pid int32) {
+	detail.Open(pid)
+	showDetail()
+}
+
+// openStacks shows the kernel stacks of a process until escape is pressed
+func openStacks(pid int32) {
+	detail.OpenStacks(pid)
+	showDetail()
+}
+
+func showDetail() {
+	focusables[focus].backGround()
+	detailVisible = true
+
+	ui.On("<up>", "k", func(e ui.Event) {
+		detail.Up()
+		detailRefreshed <- true
+	})
+	ui.On("<down>", "j", func(e ui.Event) {
+		detail.Down()
+		detailRefreshed <- true
+	})
+	ui.On("<escape>", func(e ui.Event) {
+		detail.Close()
+		ui.Off("<up>", "k", "<down>", "j")
+		ui.On("<escape>", hideHelp)
+		focusables[focus].foreGround()
+		detailVisible = false
+		detailRefreshed <- true
+	})
+}
+
+// renderModal draws the open dialog, if any, over the widgets
+func renderModal() {
+	if signalVisible {
+		ui.Render(signalMenu)
+	}
+	if prioVisible {
+		ui.Render(prioMenu)
+	}
+	if detailVisible {
+		ui.Render(detail)
+	}
+}
+
+// searchKeys are the keys that can be typed into the process search
+var searchKeys = func() []string {
+	keys := []string{"<space>", "<backspace>", "<C-8>"}
+	for c := '!'; c <= '~'; c++ {
+		keys = append(keys, string(c))
+	}
+	return keys
+}()
+
+// openSearch sends every typed key to the process search, including the
+// keys normally bound to other actions, until enter or escape is pressed
+func openSearch() {
+	focusables[focus].backGround()
+	ui.Off("<tab>")
+
+	ui.On(searchKeys, func(e ui.Event) {
+		proc.SearchKey(e.Key)
+		procKeyPressed <- true
+	})
+	ui.On("<enter>", func(e ui.Event) {
+		closeSearch(true)
+	})
+	ui.On("<escape>", func(e ui.Event) {
+		closeSearch(false)
+	})
+}
+
+func closeSearch(keep bool) {
+	proc.EndSearch(keep)
+	ui.Off(searchKeys)
+	ui.Off("<enter>")
+	keyBinds()
+	focusables[focus].foreGround()
+	procKeyPressed <- true
+}
+
+// setFocus moves the keyboard from the focused widget to focusables[i]
+func setFocus(i int) {
+	old := focusables[focus]
+	old.backGround()
+	old.table.Cursor = ui.Color(colorscheme.BgCursor)
+	old.keyPressed <- true
+
+	focus = i
+	new := focusables[focus]
+	new.foreGround()
+	new.table.Cursor = ui.Color(colorscheme.Cursor)
+	new.keyPressed <- true
+}
 
 func handleColorscheme(cs string) {
 	switch cs {
@@ -72,13 +298,18 @@ func setupGrid() {
 	ui.Body.Cols = 24
 	ui.Body.Rows = 12
 
-	ui.Body.Set(0, 0, 24, 2, cpu)
+	ui.Body.Set(0, 0, 12, 2, cpu)
+	ui.Body.Set(12, 0, 24, 2, fc)
 
-	ui.Body.Set(0, 2, 10, 8, disk)
-	ui.Body.Set(10, 2, 18, 8, tape)
-	ui.Body.Set(18, 2, 24, 8, mem)
+	ui.Body.Set(0, 2, 10, 6, disk)
+	ui.Body.Set(0, 6, 10, 8, fs)
+	ui.Body.Set(10, 2, 18, 6, tape)
+	ui.Body.Set(10, 6, 18, 8, chgr)
+	ui.Body.Set(18, 2, 24, 5, mem)
+	ui.Body.Set(18, 5, 24, 8, daemons)
 
-	ui.Body.Set(0, 8, 8, 12, net)
+	ui.Body.Set(0, 8, 8, 10, net)
+	ui.Body.Set(0, 10, 8, 12, events)
 	ui.Body.Set(8, 8, 24, 12, proc)
 }
 
@@ -95,12 +326,7 @@ func keyBinds() {
 		helpVisible = !helpVisible
 	})
 	// hides help menu
-	ui.On("<escape>", func(e ui.Event) {
-		if helpVisible {
-			helpToggled <- true
-			helpVisible = false
-		}
-	})
+	ui.On("<escape>", hideHelp)
 
 	ui.On("h", func(e ui.Event) {
 		zoom += zoomInterval
@@ -123,35 +349,20 @@ func keyBinds() {
 	})
 
 	ui.On("<tab>", func(e ui.Event) {
-		switch focus {
-		case 0:
-			proc.BackGround()
-			proc.Cursor = ui.Color(colorscheme.BgCursor)
-			procKeyPressed <- true
-			disk.ForeGround()
-			disk.Cursor = ui.Color(colorscheme.Cursor)
-			diskKeyPressed <- true
-			focus = 1
-		case 1:
-			disk.BackGround()
-			disk.Cursor = ui.Color(colorscheme.BgCursor)
-			diskKeyPressed <- true
-			tape.ForeGround()
-			tape.Cursor = ui.Color(colorscheme.Cursor)
-			tapeKeyPressed <- true
-			focus = 2
-		case 2:
-			tape.BackGround()
-			tape.Cursor = ui.Color(colorscheme.BgCursor)
-			tapeKeyPressed <- true
-			proc.ForeGround()
-			proc.Cursor = ui.Color(colorscheme.Cursor)
-			procKeyPressed <- true
-			focus = 0
+		if signalVisible || prioVisible || detailVisible {
+			return
 		}
+		setFocus((focus + 1) % len(focusables))
 	})
 }
 
+func hideHelp(e ui.Event) {
+	if helpVisible {
+		helpToggled <- true
+		helpVisible = false
+	}
+}
+
 func termuiColors() {
 	ui.Theme.Fg = ui.Color(colorscheme.Fg)
 	ui.Theme.Bg = ui.Color(colorscheme.Bg)
@@ -178,6 +389,13 @@ func widgetColors() {
 		LineColor["Average"] = ui.Color(colorscheme.CPULines[0])
 	}
 	cpu.LineColor = LineColor
+
+	disk.DimColor = ui.Color(colorscheme.Dim)
+	disk.AlertColor = ui.Color(colorscheme.Alert)
+	tape.AlertColor = ui.Color(colorscheme.Alert)
+	proc.AlertColor = ui.Color(colorscheme.Alert)
+	proc.NewColor = ui.Color(colorscheme.New)
+	daemons.AlertColor = ui.Color(colorscheme.Alert)
 }
 
 // load widgets asynchronously but wait till they are all finished
@@ -197,7 +415,7 @@ func initWidgets() {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		proc = w.NewProc(procKeyPressed)
+		proc = w.NewProc(procKeyPressed, procFilters)
 	}()
 
 	wg.Add(1)
@@ -212,16 +430,123 @@ func initWidgets() {
 		disk = w.NewDisk(diskKeyPressed)
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		fs = w.NewFsUsage()
+	}()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		tape = w.NewTape(tapeKeyPressed)
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		chgr = w.NewChanger()
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		fc = w.NewFC()
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		events = w.NewEvents(eventsKeyPressed)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		daemons = w.NewDaemons(daemonNames)
+	}()
+
 	wg.Wait()
 }
 
+// mcfCheck validates the mcf without starting the TUI. It exits 0 when the
+// mcf is clean, 1 when there are findings and 2 when it can't be read.
+func mcfCheck(args []string) int {
+	path := utils.MCFPATH
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	findings, err := utils.CheckMcf(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 2
+	}
+
+	for _, f := range findings {
+		fmt.Printf("%s:%d: %s\n", path, f.Line, f.Msg)
+	}
+	if len(findings) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// loadProcFilters builds the process filter presets from the filters file
+// and the -filter flag. The filters from the flag come first so that they
+// are the ones shown at startup.
+func loadProcFilters(path, rules string, pathSet bool) error {
+	filters, err := utils.ReadProcFilters(path)
+	if err != nil {
+		// the default file is optional
+		if pathSet || !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if len(filters) == 0 {
+		filters = utils.DefaultProcFilters
+	}
+
+	if rules != "" {
+		f, err := utils.NewProcFilter("custom", rules)
+		if err != nil {
+			return err
+		}
+		filters = append([]utils.ProcFilter{f}, filters...)
+	}
+
+	procFilters = filters
+	return nil
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "mcf-check" {
+		os.Exit(mcfCheck(os.Args[2:]))
+	}
+
+	filterRules := flag.String("filter", "", "process filter rules, such as \"+prefix:sam- +cmdline:rsync -user:root\"")
+	filterPath := flag.String("filters", utils.PROCFILTERPATH, "file of process filter presets")
+	flag.BoolVar(&readOnly, "read-only", false, "disable sending signals to and changing the priority of processes")
+	daemonList := flag.String("daemons", strings.Join(utils.DefaultDaemons, ","), "comma separated daemons that should be running, besides the ones the mcf needs")
+	flag.Parse()
+
+	for _, d := range strings.Split(*daemonList, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			daemonNames = append(daemonNames, d)
+		}
+	}
+
+	pathSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "filters" {
+			pathSet = true
+		}
+	})
+	if err := loadProcFilters(*filterPath, *filterRules, pathSet); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
 	os.Setenv("TERM", "xterm-256color")
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
@@ -234,7 +559,24 @@ func main() {
 
 	widgetColors()
 
+	setupFocus()
+
 	help = w.NewHelpMenu()
+	signalMenu = w.NewSignalMenu()
+	proc.Signal = openSignalMenu
+	prioMenu = w.NewPrioMenu()
+	proc.Priority = openPrioMenu
+	proc.StartSearch = openSearch
+	detail = w.NewProcDetailView(detailRefreshed)
+	proc.Detail = openDetail
+	proc.Stacks = openStacks
+	proc.Lifecycle = events.Add
+	proc.Scanned = func(procs []*utils.ProcStat) {
+		daemons.Update(procs)
+		detail.Scanned(procs)
+	}
+	proc.ReadOnly = readOnly
+	proc.Start()
 
 	// inits termui
 	err := ui.Init()
@@ -273,18 +615,31 @@ func main() {
 				case <-termResized:
 					ui.Clear()
 					ui.Render(ui.Body)
+				case <-signalToggled:
+					ui.Render(ui.Body)
+					renderModal()
+				case <-prioToggled:
+					ui.Render(ui.Body)
+					renderModal()
+				case <-detailRefreshed:
+					ui.Render(ui.Body)
+					renderModal()
 				case <-procKeyPressed:
 					ui.Render(proc)
+					renderModal()
 				case <-diskKeyPressed:
 					ui.Render(disk)
 				case <-tapeKeyPressed:
 					ui.Render(tape)
+				case <-eventsKeyPressed:
+					ui.Render(events)
 				case <-netKeyPressed:
 					ui.Render(net)
 				case <-zoomed:
 					ui.Render(cpu, mem)
 				case <-drawTick.C:
 					ui.Render(ui.Body)
+					renderModal()
 				}
 			}
 		}
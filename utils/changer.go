@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var changerRxp = regexp.MustCompile(`^sch(\d+)$`)
+
+const CHANGERPATH = "/sys/class/scsi_changer"
+
+// Changer is a media changer (robot) and the tape drives behind it
+type Changer struct {
+	Name   string
+	Vendor string
+	Model  string
+	HCTL   string
+	Drives []string
+}
+
+// FindChangers returns every media changer the kernel knows about with
+// the tape drives from FindDevices that share its SCSI host and target.
+// If no drive shares the target and the changer is the only one on its SCSI
+// host, the drives on that host are used. Drives that can't be matched to a
+// single changer are left out of every changer.
+func FindChangers() ([]Changer, error) {
+	var changers []Changer
+	dirents, err := ioutil.ReadDir(CHANGERPATH)
+	if err != nil {
+		return changers, err
+	}
+
+	drives, _ := FindDevices()
+	hctls := make(map[string]string, len(drives))
+	for _, drive := range drives {
+		hctls[drive] = scsiAddr(path.Join(DEVPATH, drive))
+	}
+
+	for _, dirent := range dirents {
+		if !changerRxp.MatchString(dirent.Name()) {
+			continue
+		}
+		dir := path.Join(CHANGERPATH, dirent.Name())
+		changers = append(changers, Changer{
+			Name:   dirent.Name(),
+			Vendor: readSysString(path.Join(dir, "device", "vendor")),
+			Model:  readSysString(path.Join(dir, "device", "model")),
+			HCTL:   scsiAddr(dir),
+		})
+	}
+	assignDrives(changers, drives, hctls)
+
+	sort.Slice(changers, func(i, j int) bool {
+		return devNum(changerRxp, changers[i].Name) < devNum(changerRxp, changers[j].Name)
+	})
+	return changers, nil
+}
+
+// assignDrives adds each drive to the changer at the same SCSI target, or
+// failing that to the only changer on the same SCSI host. With two changers
+// on a host there is no telling which library a drive is in.
+func assignDrives(changers []Changer, drives []string, hctls map[string]string) {
+	onHost := make(map[string]int)
+	for _, c := range changers {
+		onHost[hctlHost(c.HCTL)]++
+	}
+
+	for i := range changers {
+		c := &changers[i]
+		for _, drive := range drives {
+			if sameTarget(c.HCTL, hctls[drive]) {
+				c.Drives = append(c.Drives, drive)
+			}
+		}
+		if len(c.Drives) > 0 || onHost[hctlHost(c.HCTL)] != 1 {
+			continue
+		}
+		for _, drive := range drives {
+			if sameHost(c.HCTL, hctls[drive]) {
+				c.Drives = append(c.Drives, drive)
+			}
+		}
+	}
+}
+
+// ChangerRequests returns the number of SCSI commands issued to the changer.
+// The ch driver has no move statistics, so a change in this count between
+// two updates is the only sign of robot activity the kernel exposes.
+func ChangerRequests(name string) (int64, error) {
+	return readSysHex(path.Join(CHANGERPATH, name, "device", "iorequest_cnt"))
+}
+
+// scsiAddr returns the host:channel:target:lun of the scsi device behind
+// a sysfs class directory
+func scsiAddr(dir string) string {
+	link, err := os.Readlink(path.Join(dir, "device"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(link)
+}
+
+// hctlHost returns the host of a host:channel:target:lun address
+func hctlHost(hctl string) string {
+	parts := strings.Split(hctl, ":")
+	if len(parts) != 4 {
+		return ""
+	}
+	return parts[0]
+}
+
+func sameHost(a, b string) bool {
+	as := strings.Split(a, ":")
+	bs := strings.Split(b, ":")
+	if len(as) != 4 || len(bs) != 4 {
+		return false
+	}
+	return as[0] == bs[0]
+}
+
+func sameTarget(a, b string) bool {
+	as := strings.Split(a, ":")
+	bs := strings.Split(b, ":")
+	if len(as) != 4 || len(bs) != 4 {
+		return false
+	}
+	return as[0] == bs[0] && as[1] == bs[1] && as[2] == bs[2]
+}
+
+func devNum(rxp *regexp.Regexp, name string) int {
+	match := rxp.FindStringSubmatch(name)
+	if match == nil {
+		return -1
+	}
+	n, _ := strconv.Atoi(match[1])
+	return n
+}
+
+func readSysString(file string) string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readSysHex reads the 0x prefixed counters scsi devices keep in sysfs
+func readSysHex(file string) (int64, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 0, 64)
+}
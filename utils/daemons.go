@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"strings"
+)
+
+// DefaultDaemons are the daemons a VSM host runs whatever its mcf has
+var DefaultDaemons = []string{"sam-fsd", "sam-archiverd", "sam-stagerd"}
+
+// mcf eqtypes of removable media equipment, which needs the media daemons
+var mediaEqtypes = map[string]bool{
+	"rb": true, "sk": true, "im": true,
+	"tp": true, "li": true, "ti": true, "sg": true, "se": true, "sf": true, "od": true,
+}
+
+// ExpectedDaemons returns the daemons the host should be running: the given
+// ones, the media daemons when the mcf has robots or drives, and
+// sam-sharefsd when it has shared filesystems.
+func ExpectedDaemons(daemons []string) []string {
+	var expected []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			expected = append(expected, name)
+		}
+	}
+
+	for _, d := range daemons {
+		add(d)
+	}
+
+	entries, _, err := ReadMcf(MCFPATH)
+	if err != nil {
+		return expected
+	}
+	for _, e := range entries {
+		switch {
+		case mediaEqtypes[e.Type]:
+			add("sam-amld")
+			add("sam-catserverd")
+		case IsFsType(e.Type) && hasParam(e.Params, "shared"):
+			add("sam-sharefsd")
+		}
+	}
+	return expected
+}
+
+// hasParam returns true if the comma separated additional parameters of an
+// mcf entry include param
+func hasParam(params, param string) bool {
+	for _, p := range strings.Split(params, ",") {
+		if strings.TrimSpace(p) == param {
+			return true
+		}
+	}
+	return false
+}
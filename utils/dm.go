@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+const SYSBLOCKPATH = "/sys/block"
+
+// DmSlaves returns the kernel names of the devices below a device-mapper
+// device, which for a multipath device are its paths. It returns nothing for
+// devices that are not device-mapper devices.
+func DmSlaves(dev string) []string {
+	dirents, err := ioutil.ReadDir(path.Join(SYSBLOCKPATH, dev, "slaves"))
+	if err != nil {
+		return nil
+	}
+
+	var slaves []string
+	for _, dirent := range dirents {
+		slaves = append(slaves, dirent.Name())
+	}
+	sort.Strings(slaves)
+	return slaves
+}
+
+// IsMultipath returns true if dev is a multipath device
+func IsMultipath(dev string) bool {
+	uuid := readSysString(path.Join(SYSBLOCKPATH, dev, "dm", "uuid"))
+	return strings.HasPrefix(uuid, "mpath-")
+}
+
+// PathState returns the scsi device state of a path, such as running,
+// offline or blocked. It is empty when sysfs doesn't have a state for dev.
+func PathState(dev string) string {
+	return readSysString(path.Join(SYSBLOCKPATH, dev, "device", "state"))
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var fcHostRxp = regexp.MustCompile(`^host(\d+)$`)
+
+var fcStatFiles = []string{
+	"tx_frames",
+	"rx_frames",
+	"tx_words",
+	"rx_words",
+	"link_failure_count",
+	"loss_of_sync_count",
+	"invalid_crc_count",
+	"error_frames",
+}
+
+const FCHOSTPATH = "/sys/class/fc_host"
+
+// fc_host statistics read as all ones when the driver doesn't keep them
+const fcStatNA = 0xffffffffffffffff
+
+// FcHost is a Fibre Channel host adapter port
+type FcHost struct {
+	Name     string
+	PortName string
+	Speed    string
+	State    string
+	// Stats are the counters that could be read; a counter the driver
+	// doesn't keep is left out
+	Stats map[string]uint64
+}
+
+// FindFcHosts returns the name of every Fibre Channel host, sorted by host number
+func FindFcHosts() ([]string, error) {
+	var hosts []string
+	dirents, err := ioutil.ReadDir(FCHOSTPATH)
+	if err != nil {
+		return hosts, err
+	}
+
+	for _, dirent := range dirents {
+		if fcHostRxp.MatchString(dirent.Name()) {
+			hosts = append(hosts, dirent.Name())
+		}
+	}
+
+	sort.Slice(hosts, func(i, j int) bool {
+		return devNum(fcHostRxp, hosts[i]) < devNum(fcHostRxp, hosts[j])
+	})
+	return hosts, nil
+}
+
+// GetFcHost reads the port attributes and statistics of a Fibre Channel
+// host. The error is for the first counter that couldn't be read, which is
+// left out of Stats; the rest of the port is still returned.
+func GetFcHost(name string) (FcHost, error) {
+	dir := path.Join(FCHOSTPATH, name)
+	h := FcHost{
+		Name:     name,
+		PortName: readSysString(path.Join(dir, "port_name")),
+		Speed:    readSysString(path.Join(dir, "speed")),
+		State:    readSysString(path.Join(dir, "port_state")),
+		Stats:    make(map[string]uint64, len(fcStatFiles)),
+	}
+
+	var firstErr error
+	for _, stat := range fcStatFiles {
+		data, err := ioutil.ReadFile(path.Join(dir, "statistics", stat))
+		if err == nil {
+			var i uint64
+			i, err = strconv.ParseUint(strings.TrimSpace(string(data)), 0, 64)
+			if err == nil {
+				if i != fcStatNA {
+					h.Stats[stat] = i
+				}
+				continue
+			}
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return h, firstErr
+}
+
+// TapeHost returns the scsi host, as hostN, that a tape drive is attached to
+func TapeHost(drive string) string {
+	return scsiHost(path.Join(DEVPATH, drive))
+}
+
+// BlockHost returns the scsi host, as hostN, that a block device is attached to
+func BlockHost(dev string) string {
+	return scsiHost(path.Join(SYSBLOCKPATH, dev))
+}
+
+func scsiHost(dir string) string {
+	hctl := strings.Split(scsiAddr(dir), ":")
+	if len(hctl) != 4 {
+		return ""
+	}
+	return "host" + hctl[0]
+}
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const KMSGPATH = "/dev/kmsg"
+
+// kernel log files to follow when /dev/kmsg can't be read
+var kernLogFiles = []string{
+	"/var/log/kern.log",
+	"/var/log/messages",
+}
+
+// KernelEvent is a message from the kernel log
+type KernelEvent struct {
+	Time time.Time
+	Msg  string
+}
+
+// TailKernelLog sends every kernel log message to events, starting with the
+// messages already in the kernel ring buffer. It reads /dev/kmsg, falling back
+// to following the kernel log file if that isn't readable, and only returns
+// if neither can be read.
+func TailKernelLog(events chan<- KernelEvent) error {
+	f, err := os.Open(KMSGPATH)
+	if err == nil {
+		err = readKmsg(f, events)
+		f.Close()
+		if err == nil {
+			return nil
+		}
+	}
+
+	for _, name := range kernLogFiles {
+		if _, err = os.Stat(name); err == nil {
+			return followKernLog(name, events)
+		}
+	}
+	return err
+}
+
+// readKmsg reads records from /dev/kmsg, which look like
+// "6,1234,5678901,-;message" with the timestamp in microseconds since boot.
+func readKmsg(f *os.File, events chan<- KernelEvent) error {
+	boot := bootTime()
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			// the oldest records were overwritten before they were read
+			if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.EPIPE {
+				continue
+			}
+			return err
+		}
+		// continuation lines with device properties
+		if strings.HasPrefix(line, " ") {
+			continue
+		}
+
+		i := strings.Index(line, ";")
+		if i < 0 {
+			continue
+		}
+		prefix := strings.Split(line[:i], ",")
+		if len(prefix) < 3 {
+			continue
+		}
+		usec, _ := strconv.ParseInt(prefix[2], 10, 64)
+
+		events <- KernelEvent{
+			Time: boot.Add(time.Duration(usec) * time.Microsecond),
+			Msg:  strings.TrimSpace(line[i+1:]),
+		}
+	}
+}
+
+// followKernLog follows a syslog file, sending the kernel messages added to it
+func followKernLog(name string, events chan<- KernelEvent) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	// the start of a line still being written, read before the next one
+	var partial string
+	for {
+		line, err := r.ReadString('\n')
+		offset += int64(len(line))
+		if err == io.EOF {
+			partial += line
+			time.Sleep(time.Second)
+			// start over if the log was rotated or truncated
+			if fi, err := os.Stat(name); err == nil && fi.Size() < offset {
+				f.Close()
+				f, err = os.Open(name)
+				if err != nil {
+					return err
+				}
+				r.Reset(f)
+				offset = 0
+				partial = ""
+			}
+			continue
+		}
+		if err != nil {
+			f.Close()
+			return err
+		}
+		line, partial = partial+line, ""
+
+		// "Oct 18 10:00:00 host kernel: message"
+		i := strings.Index(line, " kernel: ")
+		if i < 0 {
+			continue
+		}
+		t := time.Now()
+		if len(line) > 15 {
+			if ts, err := time.ParseInLocation(time.Stamp, line[:15], time.Local); err == nil {
+				t = ts.AddDate(time.Now().Year(), 0, 0)
+			}
+		}
+		events <- KernelEvent{
+			Time: t,
+			Msg:  strings.TrimSpace(line[i+len(" kernel: "):]),
+		}
+	}
+}
+
+func bootTime() time.Time {
+	data, err := ioutil.ReadFile("/proc/uptime")
+	if err != nil {
+		return time.Now()
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return time.Now()
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return time.Now()
+	}
+	return time.Now().Add(-time.Duration(uptime * float64(time.Second)))
+}
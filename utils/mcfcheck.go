@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// CheckMcf validates the mcf at path and returns every problem found, ordered
+// by line. The error is only set if the mcf could not be read.
+func CheckMcf(path string) ([]*McfError, error) {
+	entries, findings, err := ReadMcf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ords := make(map[int]int)
+	blockdevs := make(map[uint64]McfEntry)
+	for _, e := range entries {
+		if first, ok := ords[e.Ord]; ok {
+			findings = append(findings, &McfError{e.Line,
+				fmt.Sprintf("duplicate equipment ordinal %d, first used on line %d", e.Ord, first)})
+		} else {
+			ords[e.Ord] = e.Line
+		}
+
+		if !KnownEqtype(e.Type) {
+			findings = append(findings, &McfError{e.Line, fmt.Sprintf("unknown eqtype %s", e.Type)})
+			continue
+		}
+
+		if IsFsDevType(e.Type) {
+			rdev, err := blockDev(e.Path)
+			if err != nil {
+				findings = append(findings, &McfError{e.Line, err.Error()})
+				continue
+			}
+			if first, ok := blockdevs[rdev]; ok {
+				findings = append(findings, &McfError{e.Line,
+					fmt.Sprintf("%s is the same device as %s on line %d", e.Path, first.Path, first.Line)})
+				continue
+			}
+			blockdevs[rdev] = e
+			continue
+		}
+
+		// robots and drives are character devices, anything that isn't a
+		// path is a remote or logical name that can't be checked here
+		if strings.HasPrefix(e.Path, "/") {
+			if _, err := os.Stat(e.Path); err != nil {
+				findings = append(findings, &McfError{e.Line, fmt.Sprintf("%s does not exist", e.Path)})
+			}
+		}
+	}
+
+	fses, errs := mcfFilesystems(entries)
+	findings = append(findings, errs...)
+	for _, fs := range fses {
+		if err := validateFs(fs); err != nil {
+			findings = append(findings, err.(*McfError))
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+// blockDev returns the device number of the block device at path
+func blockDev(path string) (uint64, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return 0, fmt.Errorf("%s does not exist", path)
+	}
+	fi, err := os.Stat(resolved)
+	if err != nil {
+		return 0, fmt.Errorf("%s does not exist", path)
+	}
+	if fi.Mode()&os.ModeDevice == 0 || fi.Mode()&os.ModeCharDevice != 0 {
+		return 0, fmt.Errorf("%s is not a block device", path)
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("%s: unable to read device number", path)
+	}
+	return uint64(st.Rdev), nil
+}
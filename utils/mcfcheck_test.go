@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckMcf(t *testing.T) {
+	// the fixture devices don't exist, so every one of them is also reported
+	// as missing; only the finding each fixture is for is checked
+	tests := []struct {
+		file string
+		line int
+		msg  string
+	}{
+		{"dup-ordinal.mcf", 4, "duplicate equipment ordinal 10, first used on line 3"},
+		{"unknown-eqtype.mcf", 3, "unknown eqtype zz"},
+		{"orphan-family.mcf", 4, `family set "samfs2" is not a filesystem`},
+		{"ms-with-mm.mcf", 1, "invalid devices found for samfs1"},
+	}
+
+	for _, tt := range tests {
+		findings, err := CheckMcf(filepath.Join("testdata", "mcf", tt.file))
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		found := false
+		for _, f := range findings {
+			if f.Line == tt.line && strings.Contains(f.Msg, tt.msg) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: no %q on line %d in %v", tt.file, tt.msg, tt.line, findings)
+		}
+	}
+}
+
+func TestCheckMcfMissing(t *testing.T) {
+	if _, err := CheckMcf(filepath.Join("testdata", "mcf", "none.mcf")); err == nil {
+		t.Error("no error for a missing mcf")
+	}
+}
@@ -82,11 +82,23 @@ type Sockets struct {
 func (n *NetPerf) Update(pids []int32) error {
 	n.mu.Lock()
 	defer n.mu.Unlock()
+
+	// the capture goroutines look up Pstats under the socket map lock
+	n.SockMaps.mu.Lock()
+	keep := make(map[int32]bool, len(pids))
 	for _, pid := range pids {
+		keep[pid] = true
 		if _, ok := n.Pstats[pid]; !ok {
 			n.Pstats[pid] = &Pidstat{}
 		}
 	}
+	// forget processes that have exited or are no longer shown
+	for pid := range n.Pstats {
+		if !keep[pid] {
+			delete(n.Pstats, pid)
+		}
+	}
+	n.SockMaps.mu.Unlock()
 
 	f, err := os.Open(tcppath)
 	if err != nil {
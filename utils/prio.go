@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"syscall"
+)
+
+// I/O scheduling classes of ioprio_set(2)
+const (
+	IOPrioClassNone = iota
+	IOPrioClassRT
+	IOPrioClassBE
+	IOPrioClassIdle
+)
+
+// IOPrioClasses are the names ionice uses for each class
+var IOPrioClasses = []string{"none", "rt", "be", "idle"}
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	// IOPrioLevels is the number of priority levels in the rt and be classes
+	IOPrioLevels = 8
+	// NiceUnchanged is the nice value that SetPriority leaves as it is
+	NiceUnchanged = math.MaxInt32
+)
+
+// GetIOPrio returns the I/O scheduling class and priority level of a process
+func GetIOPrio(pid int32) (int, int, error) {
+	r, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_GET, ioprioWhoProcess, uintptr(pid), 0)
+	if errno != 0 {
+		return 0, 0, errno
+	}
+	return int(r) >> ioprioClassShift, int(r) & (1<<ioprioClassShift - 1), nil
+}
+
+// FormatIOPrio formats an I/O class and level as "be/4", or just the class
+// for the classes without levels
+func FormatIOPrio(class, level int) string {
+	if class < 0 || class >= len(IOPrioClasses) {
+		return "?"
+	}
+	if class == IOPrioClassRT || class == IOPrioClassBE {
+		return fmt.Sprintf("%s/%d", IOPrioClasses[class], level)
+	}
+	return IOPrioClasses[class]
+}
+
+// SetPriority sets the nice value and the I/O class and level of every
+// thread of the process, leaving the nice value as it is if nice is
+// NiceUnchanged and the I/O scheduling if class is -1. Linux keeps both per
+// thread, so setting them for the PID alone would leave the other threads of
+// a multithreaded mover as they were. Like Signal, nothing is set if the PID
+// has been reused, and both errors are then ErrPidReused. Otherwise the nice
+// value and the I/O scheduling are set independently and each returns its
+// own error. Lowering the nice value or using the rt class needs root.
+func (r ProcHandle) SetPriority(nice, class, level int) (error, error) {
+	if err := r.check(); err != nil {
+		return err, err
+	}
+	root := r.root
+	if root == "" {
+		root = PROCROOT
+	}
+	names, err := readDirNames(procPath(root, r.Pid, "task"))
+	if err != nil {
+		return err, err
+	}
+	if class != IOPrioClassRT && class != IOPrioClassBE {
+		level = 0
+	}
+	ioprio := uintptr(class<<ioprioClassShift | level)
+
+	var niceErr, ioErr error
+	for _, name := range names {
+		tid, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		// threads can exit while the others are set
+		if nice != NiceUnchanged {
+			err = syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice)
+			if err != nil && err != syscall.ESRCH && niceErr == nil {
+				niceErr = err
+			}
+		}
+		if class < 0 {
+			continue
+		}
+		_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprio)
+		if errno != 0 && errno != syscall.ESRCH && ioErr == nil {
+			ioErr = errno
+		}
+	}
+	return niceErr, ioErr
+}
@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PROCFILTERPATH is the default file of process filter presets
+const PROCFILTERPATH = "/etc/opt/vsm/vsmtop.filters"
+
+// kinds of process rules
+const (
+	RulePrefix  = "prefix"  // command name starts with the value
+	RuleCmdline = "cmdline" // regexp matches the full command line
+	RuleUser    = "user"    // process is owned by the user name or uid
+	RuleTree    = "tree"    // process is a descendant of a process with the name
+)
+
+// ProcRule includes or excludes processes. Rules are written as
+// [+|-]kind:value, for example "+prefix:sam-", "-user:root" or
+// "+cmdline:rsync.*--server"; a rule without a sign is an include rule.
+type ProcRule struct {
+	Exclude bool
+	Kind    string
+	Value   string
+	rxp     *regexp.Regexp
+	uid     int32
+}
+
+// ProcFilter is a named list of rules. A process is shown when it matches
+// any include rule and none of the exclude rules. A filter with no include
+// rules starts out with every process.
+type ProcFilter struct {
+	Name  string
+	Rules []ProcRule
+}
+
+// DefaultProcFilters are the presets used when no filters are configured
+var DefaultProcFilters = []ProcFilter{
+	mustProcFilter("vsm", "+prefix:sam- +tree:sam-fsd"),
+	mustProcFilter("movers", `+prefix:sam- +cmdline:\b(rsync|mover)\b +prefix:nfsd`),
+}
+
+func mustProcFilter(name, rules string) ProcFilter {
+	f, err := NewProcFilter(name, rules)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// NewProcFilter parses a space separated list of rules
+func NewProcFilter(name, rules string) (ProcFilter, error) {
+	f := ProcFilter{Name: name}
+	for _, s := range strings.Fields(rules) {
+		r, err := ParseProcRule(s)
+		if err != nil {
+			return f, err
+		}
+		f.Rules = append(f.Rules, r)
+	}
+	return f, nil
+}
+
+// ParseProcRule parses a single [+|-]kind:value rule
+func ParseProcRule(s string) (ProcRule, error) {
+	var r ProcRule
+	switch {
+	case strings.HasPrefix(s, "-"):
+		r.Exclude = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return r, fmt.Errorf("process rule %q: missing kind", s)
+	}
+	r.Kind, r.Value = s[:i], s[i+1:]
+	if r.Value == "" {
+		return r, fmt.Errorf("process rule %q: missing value", s)
+	}
+
+	switch r.Kind {
+	case RulePrefix, RuleTree:
+	case RuleCmdline:
+		rxp, err := regexp.Compile(r.Value)
+		if err != nil {
+			return r, fmt.Errorf("process rule %q: %v", s, err)
+		}
+		r.rxp = rxp
+	case RuleUser:
+		uid, err := strconv.Atoi(r.Value)
+		if err != nil {
+			u, err := user.Lookup(r.Value)
+			if err != nil {
+				return r, fmt.Errorf("process rule %q: %v", s, err)
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+		r.uid = int32(uid)
+	default:
+		return r, fmt.Errorf("process rule %q: unknown kind %q", s, r.Kind)
+	}
+	return r, nil
+}
+
+// ReadProcFilters reads filter presets from a file with one preset per line,
+// written as "name: rule rule ...". Blank lines and lines starting with #
+// are ignored.
+func ReadProcFilters(path string) ([]ProcFilter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var filters []ProcFilter
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: missing preset name", path, n)
+		}
+		filter, err := NewProcFilter(strings.TrimSpace(line[:i]), line[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		filters = append(filters, filter)
+	}
+	return filters, scanner.Err()
+}
+
+// NeedsTree returns true if the filter has tree rules, which need the parent
+// of every process
+func (f ProcFilter) NeedsTree() bool {
+	for _, r := range f.Rules {
+		if r.Kind == RuleTree {
+			return true
+		}
+	}
+	return false
+}
+
+// ProcTree holds the name and parent of every process for tree rules
+type ProcTree struct {
+	names map[int32]string
+	ppids map[int32]int32
+}
+
+// NewProcTree records the name and parent of each process
+func NewProcTree(procs []*ProcStat) *ProcTree {
+	t := &ProcTree{
+		names: make(map[int32]string, len(procs)),
+		ppids: make(map[int32]int32, len(procs)),
+	}
+	for _, p := range procs {
+		t.names[p.Pid] = p.Name
+		t.ppids[p.Pid] = p.Ppid
+	}
+	return t
+}
+
+// under returns true if an ancestor of pid is named name
+func (t *ProcTree) under(pid int32, name string) bool {
+	if t == nil {
+		return false
+	}
+	seen := make(map[int32]bool)
+	for pid = t.ppids[pid]; pid > 0 && !seen[pid]; pid = t.ppids[pid] {
+		if t.names[pid] == name {
+			return true
+		}
+		seen[pid] = true
+	}
+	return false
+}
+
+// Match returns true if the filter shows the process. The tree is only
+// needed when NeedsTree is true.
+func (f ProcFilter) Match(p *ProcStat, tree *ProcTree) bool {
+	included := true
+	for _, r := range f.Rules {
+		if !r.Exclude {
+			included = false
+			break
+		}
+	}
+
+	for _, r := range f.Rules {
+		// no need to check more include rules once one has matched
+		if !r.Exclude && included {
+			continue
+		}
+		if r.match(p, tree) {
+			if r.Exclude {
+				return false
+			}
+			included = true
+		}
+	}
+	return included
+}
+
+func (r ProcRule) match(p *ProcStat, tree *ProcTree) bool {
+	switch r.Kind {
+	case RulePrefix:
+		return strings.HasPrefix(p.Name, r.Value)
+	case RuleCmdline:
+		cmdline, err := p.Cmdline()
+		return err == nil && r.rxp.MatchString(cmdline)
+	case RuleUser:
+		uid, err := p.Uid()
+		return err == nil && uid == r.uid
+	case RuleTree:
+		return tree.under(p.Pid, r.Value)
+	}
+	return false
+}
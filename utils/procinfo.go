@@ -0,0 +1,372 @@
+package utils
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	psDisk "github.com/shirou/gopsutil/disk"
+	psProc "github.com/shirou/gopsutil/process"
+)
+
+// protocols a process can have connections in, each with its socket table
+// in <root>/net
+var sockProtos = []string{"tcp", "tcp6", "udp", "udp6"}
+
+// socket file descriptors link to "socket:[inode]"
+var sockLinkRxp = regexp.MustCompile(`^socket:\[(\d+)\]$`)
+
+// tape, changer and disk device nodes that processes have open
+var procDevRxp = regexp.MustCompile(`^/dev/(n?st\d+|sch\d+|sg\d+|sd[a-z]+\d*|dm-\d+|mapper/.+)$`)
+
+// TCP connection states from include/net/tcp_states.h
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED", "02": "SYN_SENT", "03": "SYN_RECV", "04": "FIN_WAIT1",
+	"05": "FIN_WAIT2", "06": "TIME_WAIT", "07": "CLOSE", "08": "CLOSE_WAIT",
+	"09": "LAST_ACK", "0A": "LISTEN", "0B": "CLOSING",
+}
+
+// UDP sockets are only ever connected or not
+var udpStates = map[string]string{
+	"01": "ESTABLISHED", "07": "UNCONN",
+}
+
+// ProcDetail is everything about a single process shown in its detail view
+type ProcDetail struct {
+	Pid        int32
+	Name       string
+	Cmdline    string
+	Ppid       int32
+	ParentName string
+	Children   []ProcRef
+	User       string
+	Started    time.Time
+	Threads    []ThreadStat
+	OpenFiles  int
+	Devices    []OpenFile
+	VsmFiles   []OpenFile
+	Conns      []SockConn
+	ReadBytes  uint64
+	WriteBytes uint64
+	Limits     []string
+}
+
+// ProcRef is a process by PID and name
+type ProcRef struct {
+	Pid  int32
+	Name string
+}
+
+// ThreadStat is the CPU time a thread has used, in seconds
+type ThreadStat struct {
+	Tid  int32
+	Name string
+	CPU  float64
+}
+
+// OpenFile is a file descriptor and the path it refers to
+type OpenFile struct {
+	Fd   int
+	Path string
+}
+
+// SockConn is a TCP or UDP socket of a process
+type SockConn struct {
+	Proto  string // tcp, tcp6, udp or udp6
+	Local  string
+	Remote string
+	State  string
+}
+
+// GetProcDetail gathers the detail view of a process from the /proc tree at
+// root, normally PROCROOT, finding its children in procs, the processes of
+// the last scan. Only a process that doesn't exist is an error; anything
+// unreadable is left empty.
+func GetProcDetail(root string, pid int32, procs []*ProcStat) (ProcDetail, error) {
+	d := ProcDetail{Pid: pid}
+	p, err := psProc.NewProcess(pid)
+	if err != nil {
+		return d, err
+	}
+	d.Name, err = p.Name()
+	if err != nil {
+		return d, err
+	}
+
+	d.Cmdline, _ = p.Cmdline()
+	d.User, _ = p.Username()
+	if ms, err := p.CreateTime(); err == nil {
+		d.Started = time.Unix(0, ms*int64(time.Millisecond))
+	}
+	if io, err := p.IOCounters(); err == nil {
+		d.ReadBytes = io.ReadBytes
+		d.WriteBytes = io.WriteBytes
+	}
+
+	d.Ppid, _ = p.Ppid()
+	if parent, err := psProc.NewProcess(d.Ppid); err == nil {
+		d.ParentName, _ = parent.Name()
+	}
+	d.Children = procChildren(pid, procs)
+
+	if threads, err := p.Threads(); err == nil {
+		for tid, t := range threads {
+			name := readSysString(procPath(root, pid, "task", strconv.Itoa(int(tid)), "comm"))
+			d.Threads = append(d.Threads, ThreadStat{Tid: tid, Name: name, CPU: t.User + t.System})
+		}
+		sort.Slice(d.Threads, func(i, j int) bool { return d.Threads[i].Tid < d.Threads[j].Tid })
+	}
+
+	inodes := d.readFds(root, vsmMounts())
+	d.Conns = sockConns(root, inodes)
+	d.Limits = procLimits(root, pid)
+
+	return d, nil
+}
+
+// procChildren returns the processes whose parent is pid
+func procChildren(pid int32, procs []*ProcStat) []ProcRef {
+	var children []ProcRef
+	for _, p := range procs {
+		if p.Ppid == pid {
+			children = append(children, ProcRef{Pid: p.Pid, Name: p.Name})
+		}
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Pid < children[j].Pid })
+	return children
+}
+
+// procPath returns the path of a file of a process in the /proc tree at root
+func procPath(root string, pid int32, elem ...string) string {
+	return filepath.Join(append([]string{root, strconv.Itoa(int(pid))}, elem...)...)
+}
+
+// readFds counts the open files of the process, sorting out the devices and
+// the files on VSM filesystems, and returns the inodes of its sockets
+func (d *ProcDetail) readFds(root string, mounts []string) map[string]bool {
+	inodes := make(map[string]bool)
+	dir := procPath(root, d.Pid, "fd")
+	names, err := readDirNames(dir)
+	if err != nil {
+		return inodes
+	}
+
+	for _, name := range names {
+		link, err := os.Readlink(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		d.OpenFiles++
+		fd, _ := strconv.Atoi(name)
+
+		if m := sockLinkRxp.FindStringSubmatch(link); m != nil {
+			inodes[m[1]] = true
+			continue
+		}
+
+		if procDevRxp.MatchString(link) {
+			d.Devices = append(d.Devices, OpenFile{Fd: fd, Path: link})
+			continue
+		}
+		for _, m := range mounts {
+			if link == m || strings.HasPrefix(link, m+"/") {
+				d.VsmFiles = append(d.VsmFiles, OpenFile{Fd: fd, Path: link})
+				break
+			}
+		}
+	}
+
+	sort.Slice(d.Devices, func(i, j int) bool { return d.Devices[i].Fd < d.Devices[j].Fd })
+	sort.Slice(d.VsmFiles, func(i, j int) bool { return d.VsmFiles[i].Fd < d.VsmFiles[j].Fd })
+	return inodes
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(0)
+}
+
+// vsmMounts returns the mount points of the mcf filesystems
+func vsmMounts() []string {
+	fses, _, err := ParseMcf()
+	if err != nil {
+		return nil
+	}
+	names := make(map[string]bool, len(fses))
+	for _, fs := range fses {
+		names[fs.Name] = true
+	}
+
+	parts, err := psDisk.Partitions(true)
+	if err != nil {
+		return nil
+	}
+	var mounts []string
+	for _, p := range parts {
+		if names[p.Device] {
+			mounts = append(mounts, p.Mountpoint)
+		}
+	}
+	return mounts
+}
+
+// sockConns finds the sockets with the given inodes in the TCP and UDP
+// socket tables, IPv4 and IPv6
+func sockConns(root string, inodes map[string]bool) []SockConn {
+	var conns []SockConn
+	if len(inodes) == 0 {
+		return conns
+	}
+	for _, proto := range sockProtos {
+		conns = append(conns, readSockTable(proto, filepath.Join(root, "net", proto), inodes)...)
+	}
+	return conns
+}
+
+func readSockTable(proto, path string, inodes map[string]bool) []SockConn {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	states := tcpStates
+	if strings.HasPrefix(proto, "udp") {
+		states = udpStates
+	}
+
+	var conns []SockConn
+	scanner := bufio.NewScanner(f)
+	//skip header
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || !inodes[fields[9]] {
+			continue
+		}
+		conns = append(conns, SockConn{
+			Proto:  proto,
+			Local:  hexAddr(fields[1]),
+			Remote: hexAddr(fields[2]),
+			State:  states[fields[3]],
+		})
+	}
+	return conns
+}
+
+// hexAddr converts an address from the socket tables, such as
+// "0100007F:1BC1", to "127.0.0.1:7105", and an IPv6 one to "[::1]:7105"
+func hexAddr(s string) string {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[0])%8 != 0 {
+		return s
+	}
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return s
+	}
+	// the address is in network byte order but printed as native 32 bit
+	// integers, one for IPv4 and four for IPv6
+	ip := make(net.IP, 0, len(parts[0])/2)
+	for i := 0; i < len(parts[0]); i += 8 {
+		word, err := strconv.ParseUint(parts[0][i:i+8], 16, 32)
+		if err != nil {
+			return s
+		}
+		ip = append(ip, byte(word), byte(word>>8), byte(word>>16), byte(word>>24))
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(port)))
+}
+
+// procLimits returns the lines of the limits file of a process, without the
+// header
+func procLimits(root string, pid int32) []string {
+	data, err := ioutil.ReadFile(procPath(root, pid, "limits"))
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) > 0 {
+		lines = lines[1:]
+	}
+	return lines
+}
+
+// ThreadWait is where a thread is waiting in the kernel
+type ThreadWait struct {
+	Tid   int32
+	Name  string
+	State string
+	Wchan string
+	// Stack is the kernel stack, which can only be read by root
+	Stack    []string
+	StackErr error
+}
+
+// GetProcStacks returns the wait channel and kernel stack of each thread of
+// a process in the /proc tree at root, starting with the main thread
+func GetProcStacks(root string, pid int32) ([]ThreadWait, error) {
+	taskDir := procPath(root, pid, "task")
+	names, err := readDirNames(taskDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var threads []ThreadWait
+	for _, name := range names {
+		tid, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join(taskDir, name)
+		t := ThreadWait{
+			Tid:   int32(tid),
+			Name:  readSysString(filepath.Join(dir, "comm")),
+			State: taskState(int32(tid), filepath.Join(dir, "stat")),
+			Wchan: readSysString(filepath.Join(dir, "wchan")),
+		}
+		if t.Wchan == "0" || t.Wchan == "" {
+			t.Wchan = "-"
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, "stack"))
+		if err != nil {
+			t.StackErr = err
+		} else {
+			t.Stack = strings.Split(strings.TrimSpace(string(data)), "\n")
+		}
+		threads = append(threads, t)
+	}
+
+	sort.Slice(threads, func(i, j int) bool {
+		if threads[i].Tid == pid || threads[j].Tid == pid {
+			return threads[i].Tid == pid
+		}
+		return threads[i].Tid < threads[j].Tid
+	})
+	return threads, nil
+}
+
+// taskState returns the state field of a stat file, which follows the
+// command name in parentheses
+func taskState(tid int32, file string) string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	_, fields, err := splitStat(tid, data)
+	if err != nil {
+		return ""
+	}
+	return fields[0]
+}
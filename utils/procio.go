@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProcIO is the I/O accounting of a process from /proc/<pid>/io and the
+// block I/O delay from /proc/<pid>/stat
+type ProcIO struct {
+	ReadBytes           uint64
+	WriteBytes          uint64
+	CancelledWriteBytes uint64 // written to the page cache but truncated before writeback
+	Syscr               uint64 // read syscalls
+	Syscw               uint64 // write syscalls
+	// BlkioDelay is the time spent waiting for block I/O, which is only
+	// counted when the kernel has delay accounting enabled
+	BlkioDelay time.Duration
+}
+
+// parseProcIO sets the counters found in the contents of a /proc/<pid>/io
+// file
+func parseProcIO(data []byte, pio *ProcIO) {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fields := strings.Fields(string(line))
+		if len(fields) != 2 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSuffix(fields[0], ":") {
+		case "read_bytes":
+			pio.ReadBytes = n
+		case "write_bytes":
+			pio.WriteBytes = n
+		case "cancelled_write_bytes":
+			pio.CancelledWriteBytes = n
+		case "syscr":
+			pio.Syscr = n
+		case "syscw":
+			pio.Syscw = n
+		}
+	}
+}
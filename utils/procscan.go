@@ -0,0 +1,333 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	psProc "github.com/shirou/gopsutil/process"
+)
+
+// PROCROOT is where the process scanner reads processes from
+const PROCROOT = "/proc"
+
+// CPU deltas over less time than this are mostly clock tick rounding, so a
+// scan that soon after the last one, such as one triggered by a key, reports
+// the previous CPU% instead
+const minCPUInterval = 250 * time.Millisecond
+
+// I/O priorities are asked of the kernel with a syscall per process and
+// rarely change, so they are kept this long before being asked again
+const ioprioMaxAge = 10 * time.Second
+
+// ProcStat is a process found by ProcScanner.Scan. Mem and IO are only read
+// by ReadUsage.
+type ProcStat struct {
+	Pid   int32
+	Ppid  int32
+	Name  string
+	State string // R, S, D, Z, T...
+	// Started tells a process from an earlier one with the same PID
+	Started time.Time
+	// CPU is the % of one CPU used since the last scan, or over the lifetime
+	// of the process when it is new
+	CPU   float64
+	Mem   float32 // resident memory % of total memory
+	IO    ProcIO
+	IOErr error
+	Nice  int
+
+	root  string
+	entry *procEntry
+	uid   int32
+	uidOk bool
+}
+
+// procEntry is what the scanner remembers about a process between scans.
+// The start time tells a process from an earlier one with the same PID.
+type procEntry struct {
+	start       uint64 // clock ticks after boot
+	cmdline     string
+	cmdlineRead bool
+	ticks       uint64 // user and system CPU time at the last CPU sample
+	sampled     time.Time
+	cpu         float64
+	ioClass     int
+	ioLevel     int
+	ioprioErr   error
+	ioprioRead  time.Time
+}
+
+// ProcScanner reads the processes from a /proc tree, each stat, statm and io
+// file once per scan, and works out CPU% from the difference between scans.
+// It is not safe for concurrent use.
+type ProcScanner struct {
+	root     string
+	boot     time.Time
+	pageSize uint64
+	memTotal uint64
+	entries  map[int32]*procEntry
+	buf      []byte
+}
+
+// NewProcScanner creates a scanner for the /proc tree at root, normally
+// PROCROOT.
+func NewProcScanner(root string) *ProcScanner {
+	s := &ProcScanner{
+		root:     root,
+		pageSize: uint64(os.Getpagesize()),
+		entries:  make(map[int32]*procEntry),
+		buf:      make([]byte, 4096),
+	}
+	s.memTotal = s.readMemTotal()
+	s.boot = time.Now().Add(-time.Duration(s.readUptime() * float64(time.Second)))
+	return s
+}
+
+// Scan reads the stat file of every process. Processes that exit while
+// being read are left out.
+func (s *ProcScanner) Scan() ([]*ProcStat, error) {
+	names, err := readDirNames(s.root)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entries := make(map[int32]*procEntry, len(s.entries))
+	procs := make([]*ProcStat, 0, len(names))
+	for _, name := range names {
+		pid, err := strconv.ParseInt(name, 10, 32)
+		if err != nil {
+			continue
+		}
+		p, ticks, start, err := s.readStat(int32(pid))
+		if err != nil {
+			continue
+		}
+
+		p.Started = s.boot.Add(time.Duration(start) * time.Second / psProc.ClockTicks)
+
+		e, ok := s.entries[p.Pid]
+		switch {
+		case !ok || e.start != start:
+			e = &procEntry{start: start, ticks: ticks, sampled: now}
+			if age := now.Sub(p.Started).Seconds(); age > 0 {
+				e.cpu = float64(ticks) / psProc.ClockTicks / age * 100
+			}
+		case now.Sub(e.sampled) >= minCPUInterval:
+			e.cpu = float64(ticks-e.ticks) / psProc.ClockTicks / now.Sub(e.sampled).Seconds() * 100
+			e.ticks = ticks
+			e.sampled = now
+		}
+		p.CPU = e.cpu
+		p.entry = e
+		entries[p.Pid] = e
+		procs = append(procs, p)
+	}
+	s.entries = entries
+
+	return procs, nil
+}
+
+// readStat parses /proc/<pid>/stat, returning the process with the CPU time
+// it has used and its start time, both in clock ticks
+func (s *ProcScanner) readStat(pid int32) (*ProcStat, uint64, uint64, error) {
+	data, err := s.readFile(filepath.Join(s.root, strconv.Itoa(int(pid)), "stat"))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	name, fields, err := splitStat(pid, data)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	p := &ProcStat{
+		Pid:   pid,
+		Name:  name,
+		State: fields[0],
+		root:  s.root,
+	}
+	ppid, _ := strconv.ParseInt(fields[1], 10, 32)
+	p.Ppid = int32(ppid)
+	p.Nice, _ = strconv.Atoi(fields[16])
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	start, _ := strconv.ParseUint(fields[19], 10, 64)
+	// delayacct_blkio_ticks is field 42 and missing on old kernels
+	if len(fields) > 39 {
+		blkio, _ := strconv.ParseUint(fields[39], 10, 64)
+		p.IO.BlkioDelay = time.Duration(blkio) * time.Second / psProc.ClockTicks
+	}
+	return p, utime + stime, start, nil
+}
+
+// splitStat splits a stat file into the command name and the fields after
+// it, fields[0] being field 3 of proc(5), the state
+func splitStat(pid int32, data []byte) (string, []string, error) {
+	// the command name is in parentheses and can contain spaces and
+	// parentheses itself
+	lp := bytes.IndexByte(data, '(')
+	rp := bytes.LastIndexByte(data, ')')
+	if lp < 0 || rp < lp {
+		return "", nil, fmt.Errorf("%d: bad stat", pid)
+	}
+	fields := strings.Fields(string(data[rp+1:]))
+	if len(fields) < 20 {
+		return "", nil, fmt.Errorf("%d: short stat", pid)
+	}
+	return string(data[lp+1 : rp]), fields, nil
+}
+
+// ReadUsage reads the memory and I/O accounting of a process from its statm
+// and io files. It only fails if the process has exited; an unreadable io
+// file, which needs root for other users' processes, is left in IOErr.
+func (s *ProcScanner) ReadUsage(p *ProcStat) error {
+	dir := filepath.Join(s.root, strconv.Itoa(int(p.Pid)))
+	data, err := s.readFile(filepath.Join(dir, "statm"))
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return fmt.Errorf("%d: short statm", p.Pid)
+	}
+	if s.memTotal > 0 {
+		rss, _ := strconv.ParseUint(fields[1], 10, 64)
+		p.Mem = float32(100 * float64(rss*s.pageSize) / float64(s.memTotal))
+	}
+
+	data, err = s.readFile(filepath.Join(dir, "io"))
+	if err != nil {
+		p.IOErr = err
+		return nil
+	}
+	parseProcIO(data, &p.IO)
+	return nil
+}
+
+// Handle returns the PID and start time of the process, to act on it later
+func (p *ProcStat) Handle() ProcHandle {
+	r := ProcHandle{Pid: p.Pid, root: p.root}
+	if p.entry != nil {
+		r.Start = p.entry.start
+	}
+	return r
+}
+
+// IOPrio returns the I/O scheduling class and level of the main thread. They
+// are asked of the running kernel rather than read from the /proc tree, so
+// they are only read when needed and then kept for a while.
+func (p *ProcStat) IOPrio() (int, int, error) {
+	e := p.entry
+	if e != nil && !e.ioprioRead.IsZero() && time.Since(e.ioprioRead) < ioprioMaxAge {
+		return e.ioClass, e.ioLevel, e.ioprioErr
+	}
+	class, level, err := GetIOPrio(p.Pid)
+	if e != nil {
+		e.ioClass, e.ioLevel, e.ioprioErr, e.ioprioRead = class, level, err, time.Now()
+	}
+	return class, level, err
+}
+
+// ExpireIOPrio makes IOPrio ask the kernel again, after the I/O priorities
+// have been changed.
+func (s *ProcScanner) ExpireIOPrio() {
+	for _, e := range s.entries {
+		e.ioprioRead = time.Time{}
+	}
+}
+
+// Cmdline returns the command line of the process with its arguments
+// separated by spaces. It is read once for the life of the process.
+func (p *ProcStat) Cmdline() (string, error) {
+	if p.entry != nil && p.entry.cmdlineRead {
+		return p.entry.cmdline, nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(p.root, strconv.Itoa(int(p.Pid)), "cmdline"))
+	if err != nil {
+		return "", err
+	}
+	cmdline := strings.TrimSpace(strings.Replace(string(data), "\x00", " ", -1))
+	if p.entry != nil {
+		p.entry.cmdline = cmdline
+		p.entry.cmdlineRead = true
+	}
+	return cmdline, nil
+}
+
+// Uid returns the effective user of the process, the owner of its /proc
+// directory
+func (p *ProcStat) Uid() (int32, error) {
+	if p.uidOk {
+		return p.uid, nil
+	}
+	fi, err := os.Stat(filepath.Join(p.root, strconv.Itoa(int(p.Pid))))
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("%d: no owner", p.Pid)
+	}
+	p.uid, p.uidOk = int32(st.Uid), true
+	return p.uid, nil
+}
+
+// readFile reads a small file into the scanner's buffer, which is reused by
+// the next read
+func (s *ProcScanner) readFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	n := 0
+	for {
+		if n == len(s.buf) {
+			s.buf = append(s.buf, make([]byte, len(s.buf))...)
+		}
+		m, err := f.Read(s.buf[n:])
+		n += m
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.buf[:n], nil
+}
+
+// readUptime returns the seconds since boot
+func (s *ProcScanner) readUptime() float64 {
+	fields := strings.Fields(readSysString(filepath.Join(s.root, "uptime")))
+	if len(fields) == 0 {
+		return 0
+	}
+	uptime, _ := strconv.ParseFloat(fields[0], 64)
+	return uptime
+}
+
+// readMemTotal returns the total memory in bytes
+func (s *ProcScanner) readMemTotal() uint64 {
+	data, err := ioutil.ReadFile(filepath.Join(s.root, "meminfo"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, _ := strconv.ParseUint(fields[1], 10, 64)
+			return kb * 1024
+		}
+	}
+	return 0
+}
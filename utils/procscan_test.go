@@ -0,0 +1,320 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	psProc "github.com/shirou/gopsutil/process"
+)
+
+// fakeProc is a process in a generated /proc tree
+type fakeProc struct {
+	pid   int
+	ppid  int
+	name  string
+	state string
+	utime int
+	nice  int
+	start int // clock ticks after boot
+	blkio int // clock ticks waiting for block I/O
+	// stat replaces the generated stat file, if set
+	stat   string
+	noStat bool
+	noIO   bool
+}
+
+// statFile generates a stat file with all 52 fields of proc(5)
+func (p fakeProc) statFile() string {
+	fields := make([]string, 52)
+	for i := range fields {
+		fields[i] = "0"
+	}
+	fields[0] = strconv.Itoa(p.pid)
+	fields[1] = "(" + p.name + ")"
+	fields[2] = p.state
+	fields[3] = strconv.Itoa(p.ppid)
+	fields[13] = strconv.Itoa(p.utime)
+	fields[18] = strconv.Itoa(p.nice)
+	fields[21] = strconv.Itoa(p.start)
+	fields[41] = strconv.Itoa(p.blkio)
+	return strings.Join(fields, " ") + "\n"
+}
+
+// writeProcTree generates a /proc tree with the files the scanner and
+// gopsutil read for each process
+func writeProcTree(tb testing.TB, procs []fakeProc) string {
+	root, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	write := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(data), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	write("uptime", "10000.00 9000.00\n")
+	write("meminfo", "MemTotal:       16000000 kB\nMemFree:         8000000 kB\n")
+	write("stat", "cpu  100 0 100 10000 0 0 0 0 0 0\nbtime 1700000000\n")
+
+	for _, p := range procs {
+		dir := strconv.Itoa(p.pid)
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		if p.state == "" {
+			p.state = "S"
+		}
+		if !p.noStat {
+			stat := p.stat
+			if stat == "" {
+				stat = p.statFile()
+			}
+			write(filepath.Join(dir, "stat"), stat)
+		}
+		write(filepath.Join(dir, "statm"), "2000 400 100 10 0 200 0\n")
+		write(filepath.Join(dir, "cmdline"), p.name+"\x00-v\x00")
+		write(filepath.Join(dir, "status"), fmt.Sprintf("Name:\t%s\nState:\t%s (sleeping)\nPPid:\t%d\nUid:\t0\t0\t0\t0\nGid:\t0\t0\t0\t0\n",
+			p.name, p.state, p.ppid))
+		if !p.noIO {
+			write(filepath.Join(dir, "io"), fmt.Sprintf("rchar: 100\nwchar: 200\nsyscr: %d\nsyscw: 4\nread_bytes: 4096\nwrite_bytes: 8192\ncancelled_write_bytes: 0\n",
+				p.pid))
+		}
+	}
+	return root
+}
+
+func TestProcScannerStat(t *testing.T) {
+	tests := []struct {
+		desc string
+		proc fakeProc
+		ok   bool
+		name string
+	}{
+		{"plain", fakeProc{pid: 100, ppid: 1, name: "sam-fsd", state: "S"}, true, "sam-fsd"},
+		{"spaces", fakeProc{pid: 101, ppid: 1, name: "kworker/0:1 events", state: "I"}, true, "kworker/0:1 events"},
+		{"parens", fakeProc{pid: 102, ppid: 1, name: "a) (b", state: "D"}, true, "a) (b"},
+		{"nested parens", fakeProc{pid: 103, ppid: 1, name: "((sd-pam))", state: "S"}, true, "((sd-pam))"},
+		{"only a paren", fakeProc{pid: 104, ppid: 1, name: ")", state: "R"}, true, ")"},
+		{"short", fakeProc{pid: 105, stat: "105 (short) S 1 1 1 0\n"}, false, ""},
+		{"no parens", fakeProc{pid: 106, stat: "106 noparens S 1 1 1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n"}, false, ""},
+		{"vanished", fakeProc{pid: 107, noStat: true}, false, ""},
+		{"old kernel", fakeProc{pid: 108, stat: "108 (old) S 1 1 1 0 -1 0 0 0 0 0 5 5 0 0 20 3 1 0 500\n"}, true, "old"},
+	}
+
+	var procs []fakeProc
+	for _, tt := range tests {
+		procs = append(procs, tt.proc)
+	}
+	root := writeProcTree(t, procs)
+	defer os.RemoveAll(root)
+
+	scanned, err := NewProcScanner(root).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[int32]*ProcStat)
+	for _, p := range scanned {
+		found[p.Pid] = p
+	}
+
+	for _, tt := range tests {
+		p, ok := found[int32(tt.proc.pid)]
+		if ok != tt.ok {
+			t.Errorf("%s: found %v, want %v", tt.desc, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if p.Name != tt.name {
+			t.Errorf("%s: name %q, want %q", tt.desc, p.Name, tt.name)
+		}
+		if tt.proc.stat == "" && (p.State != tt.proc.state || p.Ppid != int32(tt.proc.ppid)) {
+			t.Errorf("%s: state %s ppid %d, want %s %d", tt.desc, p.State, p.Ppid, tt.proc.state, tt.proc.ppid)
+		}
+	}
+
+	if p := found[108]; p != nil && (p.Nice != 3 || p.IO.BlkioDelay != 0) {
+		t.Errorf("old kernel: nice %d blkio %v, want 3 0", p.Nice, p.IO.BlkioDelay)
+	}
+}
+
+func TestProcScannerFields(t *testing.T) {
+	root := writeProcTree(t, []fakeProc{
+		{pid: 1, name: "init", nice: 0, start: 1},
+		{pid: 200, ppid: 1, name: "sam-archiverd", nice: -5, start: 100, utime: 50, blkio: 250},
+		{pid: 201, ppid: 200, name: "sam-arcopy", nice: 10, start: 600},
+	})
+	defer os.RemoveAll(root)
+
+	s := NewProcScanner(root)
+	procs, err := s.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPid := make(map[int32]*ProcStat)
+	for _, p := range procs {
+		byPid[p.Pid] = p
+	}
+	arch, arcopy := byPid[200], byPid[201]
+	if arch == nil || arcopy == nil {
+		t.Fatalf("got %d processes", len(procs))
+	}
+
+	if arch.Nice != -5 || arcopy.Nice != 10 {
+		t.Errorf("nice %d %d, want -5 10", arch.Nice, arcopy.Nice)
+	}
+	if arch.IO.BlkioDelay != 2500*time.Millisecond {
+		t.Errorf("blkio delay %v, want 2.5s", arch.IO.BlkioDelay)
+	}
+	if d := arcopy.Started.Sub(arch.Started); d != 5*time.Second {
+		t.Errorf("started %v apart, want 5s", d)
+	}
+	if h := arch.Handle(); h.Pid != 200 || h.Start != 100 {
+		t.Errorf("handle %+v, want pid 200 start 100", h)
+	}
+	cmdline, err := arch.Cmdline()
+	if err != nil || cmdline != "sam-archiverd -v" {
+		t.Errorf("cmdline %q, %v", cmdline, err)
+	}
+
+	if err := s.ReadUsage(arch); err != nil {
+		t.Fatal(err)
+	}
+	if arch.IOErr != nil || arch.IO.WriteBytes != 8192 || arch.IO.Syscr != 200 {
+		t.Errorf("io %+v, %v", arch.IO, arch.IOErr)
+	}
+	// 400 pages of 16000000 kB
+	if want := float32(100 * float64(400*os.Getpagesize()) / (16000000 * 1024)); arch.Mem != want {
+		t.Errorf("mem %v, want %v", arch.Mem, want)
+	}
+
+	// the same process is kept across scans, a new one with the same PID
+	// isn't
+	procs, _ = s.Scan()
+	for _, p := range procs {
+		if p.Pid == 200 && p.entry != arch.entry {
+			t.Error("process not kept across scans")
+		}
+	}
+	ioutil.WriteFile(filepath.Join(root, "200", "stat"), []byte(fakeProc{pid: 200, ppid: 1, name: "sam-archiverd", start: 900}.statFile()), 0644)
+	procs, _ = s.Scan()
+	for _, p := range procs {
+		if p.Pid == 200 && p.entry == arch.entry {
+			t.Error("reused PID taken for the old process")
+		}
+	}
+}
+
+func TestProcScannerUsage(t *testing.T) {
+	root := writeProcTree(t, []fakeProc{
+		{pid: 300, name: "sam-fsd"},
+		{pid: 301, name: "sshd", noIO: true},
+		{pid: 302, name: "sam-stagerd"},
+	})
+	defer os.RemoveAll(root)
+
+	s := NewProcScanner(root)
+	procs, err := s.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(procs) != 3 {
+		t.Fatalf("got %d processes, want 3", len(procs))
+	}
+
+	// sam-stagerd exits between the scan and reading its usage
+	if err := os.RemoveAll(filepath.Join(root, "302")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range procs {
+		err := s.ReadUsage(p)
+		switch p.Pid {
+		case 300:
+			if err != nil || p.IOErr != nil {
+				t.Errorf("sam-fsd: %v, %v", err, p.IOErr)
+			}
+		case 301:
+			// an unreadable io file isn't an error
+			if err != nil || p.IOErr == nil {
+				t.Errorf("sshd: %v, io error %v", err, p.IOErr)
+			}
+		case 302:
+			if err == nil {
+				t.Error("no error for an exited process")
+			}
+		}
+	}
+}
+
+// benchProcs is about the number of processes on a busy VSM host
+const benchProcs = 400
+
+func benchProcTree(b *testing.B) string {
+	procs := make([]fakeProc, benchProcs)
+	for i := range procs {
+		procs[i] = fakeProc{pid: 1000 + i, ppid: 1, name: fmt.Sprintf("proc%d", i), start: i, utime: i}
+	}
+	return writeProcTree(b, procs)
+}
+
+// BenchmarkProcScanner is an update of the process list with every process
+// shown
+func BenchmarkProcScanner(b *testing.B) {
+	root := benchProcTree(b)
+	defer os.RemoveAll(root)
+
+	s := NewProcScanner(root)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		procs, err := s.Scan()
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, p := range procs {
+			s.ReadUsage(p)
+		}
+	}
+}
+
+// BenchmarkProcGopsutil is the same update the way it was done before the
+// scanner, with gopsutil
+func BenchmarkProcGopsutil(b *testing.B) {
+	root := benchProcTree(b)
+	defer os.RemoveAll(root)
+
+	hostProc, set := os.LookupEnv("HOST_PROC")
+	os.Setenv("HOST_PROC", root)
+	defer func() {
+		if set {
+			os.Setenv("HOST_PROC", hostProc)
+		} else {
+			os.Unsetenv("HOST_PROC")
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		procs, err := psProc.Processes()
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, p := range procs {
+			if _, err := p.Name(); err != nil {
+				b.Fatal(err)
+			}
+			p.CPUPercent()
+			p.MemoryPercent()
+			p.IOCounters()
+			p.Status()
+		}
+	}
+}
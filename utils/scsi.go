@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"path"
+)
+
+// ScsiCounters are the I/O counters the scsi midlayer keeps for every device
+type ScsiCounters struct {
+	IoErr     int64
+	IoDone    int64
+	IoRequest int64
+	Blocked   int64
+}
+
+// TapeScsiCounters returns the scsi counters of a tape drive
+func TapeScsiCounters(drive string) (ScsiCounters, error) {
+	return getScsiCounters(path.Join(DEVPATH, drive, "device"))
+}
+
+// BlockScsiCounters returns the scsi counters of a block device
+func BlockScsiCounters(dev string) (ScsiCounters, error) {
+	return getScsiCounters(path.Join(SYSBLOCKPATH, dev, "device"))
+}
+
+func getScsiCounters(dir string) (ScsiCounters, error) {
+	var c ScsiCounters
+	var err error
+
+	c.IoErr, err = readSysHex(path.Join(dir, "ioerr_cnt"))
+	if err != nil {
+		return c, err
+	}
+	c.IoDone, err = readSysHex(path.Join(dir, "iodone_cnt"))
+	if err != nil {
+		return c, err
+	}
+	c.IoRequest, err = readSysHex(path.Join(dir, "iorequest_cnt"))
+	if err != nil {
+		return c, err
+	}
+	c.Blocked, err = readSysHex(path.Join(dir, "device_blocked"))
+	if err != nil {
+		return c, err
+	}
+	return c, nil
+}
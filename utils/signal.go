@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// pidfd syscalls, which have the same numbers on every architecture but
+// alpha and are missing from the syscall package
+const (
+	sysPidfdSendSignal = 424
+	sysPidfdOpen       = 434
+)
+
+// ErrPidReused is returned when a PID belongs to a different process than
+// the one that was scanned
+var ErrPidReused = errors.New("PID reused by another process")
+
+// ProcHandle is a process as it was scanned. The start time tells it from a
+// later process given the same PID.
+type ProcHandle struct {
+	Pid   int32
+	Start uint64 // clock ticks after boot, field 22 of stat
+
+	root string
+}
+
+// Signal sends sig to the process, unless it has exited or its PID has been
+// reused. Where the kernel has pidfds the process is pinned before its start
+// time is checked, so it can't be replaced between the check and the signal.
+func (r ProcHandle) Signal(sig syscall.Signal) error {
+	fd, _, errno := syscall.Syscall(sysPidfdOpen, uintptr(r.Pid), 0, 0)
+	pidfd := errno == 0
+	if pidfd {
+		defer syscall.Close(int(fd))
+	} else if errno != syscall.ENOSYS {
+		return errno
+	}
+
+	if err := r.check(); err != nil {
+		return err
+	}
+
+	if !pidfd {
+		return syscall.Kill(int(r.Pid), sig)
+	}
+	_, _, errno = syscall.Syscall6(sysPidfdSendSignal, fd, uintptr(sig), 0, 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// check returns ErrPidReused if the PID now belongs to a process started at
+// another time, and ESRCH if there is no such process
+func (r ProcHandle) check() error {
+	root := r.root
+	if root == "" {
+		root = PROCROOT
+	}
+	data, err := ioutil.ReadFile(filepath.Join(root, strconv.Itoa(int(r.Pid)), "stat"))
+	if err != nil {
+		return syscall.ESRCH
+	}
+	_, fields, err := splitStat(r.Pid, data)
+	if err != nil {
+		return err
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return err
+	}
+	if start != r.Start {
+		return ErrPidReused
+	}
+	return nil
+}
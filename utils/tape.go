@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 )
 
 var devRxp = regexp.MustCompile(`^(st\d*)$`)
@@ -55,7 +56,7 @@ func GetStats(dev string) (TapeStats, error) {
 		if err != nil {
 			return stats, err
 		}
-		i, err := strconv.ParseInt(string(data), 10, 64)
+		i, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
 		if err != nil {
 			return stats, err
 		}
@@ -19,6 +19,10 @@ func BytesToGB(b uint64) float64 {
 	return float64(b) / math.Pow10(9)
 }
 
+func BytesToTB(b uint64) float64 {
+	return float64(b) / math.Pow10(12)
+}
+
 func Error(issue, diagnostics string) {
 	ui.Close()
 	fmt.Println("Error caught. Exiting program.")
@@ -6,216 +6,357 @@ import (
 	"io"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
-var (
-	commentRxp   = regexp.MustCompile(`^\s*#`)
-	whitelineRxp = regexp.MustCompile(`^\s*$`)
-	fourRxp      = regexp.MustCompile(`^\s*(?P<eqid>\S+)\s+(?P<eqnum>\d+)\s+(?P<eqtype>ma|ms|mm|mr|md)\s+(?P<familyset>\S+)\s*$`)
-	fiveRxp      = regexp.MustCompile(`^\s*(?P<eqid>\S+)\s+(?P<eqnum>\d+)\s+(?P<eqtype>ma|ms|mm|mr|md)\s+(?P<familyset>\S+)\s+(?P<devstate>\S+)\s*$`)
-	sixRxp       = regexp.MustCompile(`^\s*(?P<eqid>\S+)\s+(?P<eqnum>\d+)\s+(?P<eqtype>ma|ms|mm|mr|md)\s+(?P<familyset>\S+)\s+(?P<devstate>\S+)\s+(?P<params>\S+)\s*$`)
+var stripedRxp = regexp.MustCompile(`^g(\d+)$`)
+
+const (
+	MCFPATH = "/etc/opt/vsm/mcf"
+
+	// MaxStripedGroup is the highest striped group eqtype, g127
+	MaxStripedGroup = 127
 )
 
-const mcfpath = "/etc/opt/vsm/mcf"
+// eqtypes that are not filesystems or filesystem devices but are valid in the
+// mcf: robots, tape drives, and the remote and disk archive equipment
+var otherEqtypes = map[string]string{
+	"rb": "SCSI robot",
+	"sk": "ACSLS robot",
+	"im": "IBM 3494 robot",
+	"hy": "historian",
+	"ss": "remote server",
+	"sc": "remote client",
+	"rd": "remote device",
+	"ob": "object archive",
+	"tp": "tape drive",
+	"li": "LTO tape drive",
+	"ti": "IBM 3592 tape drive",
+	"sg": "StorageTek tape drive",
+	"se": "StorageTek tape drive",
+	"sf": "StorageTek tape drive",
+	"od": "optical drive",
+}
+
+// McfEntry is a single equipment line from the mcf. Fields given as the
+// "-" placeholder are left empty.
+type McfEntry struct {
+	Line      int
+	Path      string
+	Ord       int
+	Type      string
+	FamilySet string
+	State     string
+	Params    string
+}
+
+// McfError is a problem with a line of the mcf
+type McfError struct {
+	Line int
+	Msg  string
+}
+
+func (e *McfError) Error() string {
+	return fmt.Sprintf("mcf line %d: %s", e.Line, e.Msg)
+}
 
 type DevInfo struct {
 	Path      string
 	Ord       string
 	FamilySet string
+	State     string
+	Line      int
+}
+
+// DevGroup is a striped group within a filesystem
+type DevGroup struct {
+	Name string
+	Devs []DevInfo
 }
 
 type FsInfo struct {
-	Name   string
-	Type   string
-	Params string
-	MM     []DevInfo
-	MR     []DevInfo
-	MD     []DevInfo
+	Name    string
+	Type    string
+	Params  string
+	Line    int
+	MM      []DevInfo
+	MR      []DevInfo
+	MD      []DevInfo
+	Striped []DevGroup
 }
 
-func ParseMcf() ([]FsInfo, error) {
-	f, err := os.Open(mcfpath)
-	if err != nil {
-		return []FsInfo{}, err
+// Devices returns every device in the filesystem
+func (f FsInfo) Devices() []DevInfo {
+	var devs []DevInfo
+	devs = append(devs, f.MM...)
+	devs = append(devs, f.MR...)
+	devs = append(devs, f.MD...)
+	for _, g := range f.Striped {
+		devs = append(devs, g.Devs...)
 	}
-	defer f.Close()
+	return devs
+}
 
-	fses, err := parseMcfFields(f)
+// McfWatcher polls the modification time of the mcf to tell when it has
+// been changed, so that widgets can rebuild without a restart.
+type McfWatcher struct {
+	mtime time.Time
+}
+
+func NewMcfWatcher() *McfWatcher {
+	w := &McfWatcher{}
+	w.Changed()
+	return w
+}
+
+// Changed returns true if the mcf has been modified, created or removed
+// since the last call.
+func (w *McfWatcher) Changed() bool {
+	var mtime time.Time
+	if fi, err := os.Stat(MCFPATH); err == nil {
+		mtime = fi.ModTime()
+	}
+	if mtime.Equal(w.mtime) {
+		return false
+	}
+	w.mtime = mtime
+	return true
+}
+
+// IsFsType returns true for the filesystem eqtypes
+func IsFsType(eqtype string) bool {
+	return eqtype == "ma" || eqtype == "ms"
+}
+
+// IsFsDevType returns true for the eqtypes of devices within a filesystem
+func IsFsDevType(eqtype string) bool {
+	switch eqtype {
+	case "mm", "mr", "md":
+		return true
+	}
+	return IsStripedType(eqtype)
+}
+
+// IsStripedType returns true for the striped group eqtypes g0 through g127
+func IsStripedType(eqtype string) bool {
+	match := stripedRxp.FindStringSubmatch(eqtype)
+	if match == nil {
+		return false
+	}
+	n, err := strconv.Atoi(match[1])
+	return err == nil && n <= MaxStripedGroup
+}
+
+// KnownEqtype returns true if eqtype is valid in the mcf
+func KnownEqtype(eqtype string) bool {
+	if IsFsType(eqtype) || IsFsDevType(eqtype) {
+		return true
+	}
+	_, ok := otherEqtypes[eqtype]
+	return ok
+}
+
+// ParseMcf returns the filesystems defined in the mcf. Lines and
+// filesystems with problems are left out and returned as errors, so one bad
+// line doesn't hide the rest of the mcf. The error is only set if the mcf
+// could not be read.
+func ParseMcf() ([]FsInfo, []*McfError, error) {
+	entries, errs, err := ReadMcf(MCFPATH)
 	if err != nil {
-		return []FsInfo{}, err
+		return []FsInfo{}, nil, err
 	}
 
-	for _, fs := range fses {
-		err = validateFs(fs)
-		if err != nil {
-			return []FsInfo{}, err
+	all, fsErrs := mcfFilesystems(entries)
+	errs = append(errs, fsErrs...)
+
+	fses := make([]FsInfo, 0, len(all))
+	for _, fs := range all {
+		if err := validateFs(fs); err != nil {
+			errs = append(errs, err.(*McfError))
+			continue
 		}
+		fses = append(fses, fs)
+	}
+	return fses, errs, nil
+}
+
+// ReadMcf returns every equipment entry in the mcf at path, and an error for
+// each line that isn't a valid entry.
+func ReadMcf(path string) ([]McfEntry, []*McfError, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
 	}
-	return fses, nil
+	defer f.Close()
+
+	return parseMcfEntries(f)
 }
 
 func validateFs(f FsInfo) error {
 	switch f.Type {
 	case "ma":
 		if len(f.MM) == 0 && len(f.MD) == 0 {
-			return fmt.Errorf("no metadata devices found for %s", f.Name)
+			return &McfError{f.Line, fmt.Sprintf("no metadata devices found for %s", f.Name)}
 		}
-		if len(f.MR) == 0 && len(f.MD) == 0 {
-			return fmt.Errorf("no data devices found for %s", f.Name)
+		if len(f.MR) == 0 && len(f.MD) == 0 && len(f.Striped) == 0 {
+			return &McfError{f.Line, fmt.Sprintf("no data devices found for %s", f.Name)}
 		}
 	case "ms":
 		if len(f.MD) == 0 {
-			return fmt.Errorf("no meta/data devices found for %s", f.Name)
+			return &McfError{f.Line, fmt.Sprintf("no meta/data devices found for %s", f.Name)}
 		}
-		if len(f.MM) > 0 || len(f.MR) > 0 {
-			return fmt.Errorf("invalid devices found for %s", f.Name)
+		if len(f.MM) > 0 || len(f.MR) > 0 || len(f.Striped) > 0 {
+			return &McfError{f.Line, fmt.Sprintf("invalid devices found for %s", f.Name)}
 		}
 	}
 	return nil
 }
 
-func parseMcfFields(r io.Reader) ([]FsInfo, error) {
-	var fses []FsInfo
-
-	var current FsInfo
-	currentValid := false
+// parseMcfEntries reads the equipment entries of an mcf. Lines that aren't
+// valid entries are skipped and returned as errors; the error is only set
+// if r could not be read.
+func parseMcfEntries(r io.Reader) ([]McfEntry, []*McfError, error) {
+	var entries []McfEntry
+	var errs []*McfError
 
+	lineNum := 0
 	lscanner := bufio.NewScanner(r)
 	for lscanner.Scan() {
-		line := lscanner.Text()
-
-		// comments
-		match := commentRxp.FindStringSubmatch(line)
-		if match != nil {
+		lineNum++
+		fields := strings.Fields(stripComment(lscanner.Text()))
+		// empty lines
+		if len(fields) == 0 {
 			continue
 		}
-
-		// empty lines
-		match = whitelineRxp.FindStringSubmatch(line)
-		if match != nil {
+		if len(fields) < 4 {
+			errs = append(errs, &McfError{lineNum, fmt.Sprintf("expected at least 4 fields, found %d", len(fields))})
 			continue
 		}
-
-		// four field lines
-		match = fourRxp.FindStringSubmatch(line)
-		if match != nil {
-			result := make(map[string]string)
-			for i, name := range fourRxp.SubexpNames() {
-				if i != 0 && name != "" {
-					result[name] = match[i]
-				}
-			}
-			// new filesystem definition
-			if result["eqid"] == result["familyset"] {
-				if currentValid {
-					fses = append(fses, current)
-				}
-				current = FsInfo{Name: result["eqid"], Type: result["eqtype"]}
-				currentValid = true
-				continue
-			}
-			dev := DevInfo{
-				Path:      result["eqid"],
-				Ord:       result["eqnum"],
-				FamilySet: result["familyset"],
-			}
-			switch result["eqtype"] {
-			case "mm":
-				current.MM = append(current.MM, dev)
-			case "mr":
-				current.MR = append(current.MR, dev)
-			case "md":
-				current.MD = append(current.MD, dev)
-			default:
-				return []FsInfo{}, fmt.Errorf("eqtype unkown: %s", line)
-			}
+		if len(fields) > 6 {
+			errs = append(errs, &McfError{lineNum, fmt.Sprintf("expected at most 6 fields, found %d", len(fields))})
 			continue
 		}
 
-		// five field lines
-		match = fiveRxp.FindStringSubmatch(line)
-		if match != nil {
-			result := make(map[string]string)
-			for i, name := range fiveRxp.SubexpNames() {
-				if i != 0 && name != "" {
-					result[name] = match[i]
-				}
-			}
-			// new filesystem definition
-			if result["eqid"] == result["familyset"] {
-				if currentValid {
-					fses = append(fses, current)
-				}
-				current = FsInfo{Name: result["eqid"], Type: result["eqtype"]}
-				currentValid = true
-				continue
-			}
-			dev := DevInfo{
-				Path:      result["eqid"],
-				Ord:       result["eqnum"],
-				FamilySet: result["familyset"],
-			}
-			switch result["eqtype"] {
-			case "mm":
-				current.MM = append(current.MM, dev)
-			case "mr":
-				current.MR = append(current.MR, dev)
-			case "md":
-				current.MD = append(current.MD, dev)
-			default:
-				return []FsInfo{}, fmt.Errorf("eqtype unkown: %s", line)
-			}
+		ord, err := strconv.Atoi(fields[1])
+		if err != nil || ord < 0 {
+			errs = append(errs, &McfError{lineNum, fmt.Sprintf("invalid equipment ordinal: %s", fields[1])})
 			continue
 		}
 
-		// six field lines
-		match = sixRxp.FindStringSubmatch(line)
-		if match != nil {
-			result := make(map[string]string)
-			for i, name := range sixRxp.SubexpNames() {
-				if i != 0 && name != "" {
-					result[name] = match[i]
-				}
-			}
-			// new filesystem definition
-			if result["eqid"] == result["familyset"] {
-				if currentValid {
-					fses = append(fses, current)
-				}
-				current = FsInfo{
-					Name:   result["eqid"],
-					Type:   result["eqtype"],
-					Params: result["params"],
-				}
-				currentValid = true
-				continue
-			}
-			dev := DevInfo{
-				Path:      result["eqid"],
-				Ord:       result["eqnum"],
-				FamilySet: result["familyset"],
-			}
-			switch result["eqtype"] {
-			case "mm":
-				current.MM = append(current.MM, dev)
-			case "mr":
-				current.MR = append(current.MR, dev)
-			case "md":
-				current.MD = append(current.MD, dev)
-			default:
-				return []FsInfo{}, fmt.Errorf("eqtype unkown: %s", line)
-			}
-			continue
+		e := McfEntry{
+			Line:      lineNum,
+			Path:      fields[0],
+			Ord:       ord,
+			Type:      fields[2],
+			FamilySet: placeholder(fields[3]),
+			State:     "on",
 		}
-		//fmt.Fprintf(os.Stderr, "skipping: %s\n", line)
-	}
-	if currentValid {
-		fses = append(fses, current)
+		if len(fields) > 4 && placeholder(fields[4]) != "" {
+			e.State = fields[4]
+		}
+		if len(fields) > 5 {
+			e.Params = placeholder(fields[5])
+		}
+		entries = append(entries, e)
 	}
 
 	if err := lscanner.Err(); err != nil {
-		return []FsInfo{}, err
+		return nil, nil, err
+	}
+
+	return entries, errs, nil
+}
+
+// stripComment removes the comment from an mcf line. A '#' only starts a
+// comment at the start of the line or of a field, so it can be part of a
+// device path or parameter.
+func stripComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// placeholder returns the empty string for the "-" placeholder
+func placeholder(field string) string {
+	if field == "-" {
+		return ""
+	}
+	return field
+}
+
+// mcfFilesystems groups the filesystem devices in the mcf entries by the
+// filesystem they belong to, in the order the filesystems are defined.
+// Entries that can't be placed in a filesystem are skipped and returned as
+// errors.
+func mcfFilesystems(entries []McfEntry) ([]FsInfo, []*McfError) {
+	var fses []FsInfo
+	var errs []*McfError
+	index := make(map[string]int)
+
+	for _, e := range entries {
+		if !IsFsType(e.Type) {
+			continue
+		}
+		if e.Path != e.FamilySet {
+			errs = append(errs, &McfError{e.Line, fmt.Sprintf("filesystem %s has family set %q", e.Path, e.FamilySet)})
+			continue
+		}
+		if _, ok := index[e.Path]; ok {
+			errs = append(errs, &McfError{e.Line, fmt.Sprintf("filesystem %s defined more than once", e.Path)})
+			continue
+		}
+		index[e.Path] = len(fses)
+		fses = append(fses, FsInfo{
+			Name:   e.Path,
+			Type:   e.Type,
+			Params: e.Params,
+			Line:   e.Line,
+		})
 	}
 
-	return fses, nil
+	for _, e := range entries {
+		if !IsFsDevType(e.Type) {
+			continue
+		}
+		i, ok := index[e.FamilySet]
+		if !ok {
+			errs = append(errs, &McfError{e.Line, fmt.Sprintf("family set %q is not a filesystem", e.FamilySet)})
+			continue
+		}
+		dev := DevInfo{
+			Path:      e.Path,
+			Ord:       strconv.Itoa(e.Ord),
+			FamilySet: e.FamilySet,
+			State:     e.State,
+			Line:      e.Line,
+		}
+		fs := &fses[i]
+		switch e.Type {
+		case "mm":
+			fs.MM = append(fs.MM, dev)
+		case "mr":
+			fs.MR = append(fs.MR, dev)
+		case "md":
+			fs.MD = append(fs.MD, dev)
+		default:
+			fs.addStriped(e.Type, dev)
+		}
+	}
+
+	return fses, errs
+}
+
+func (f *FsInfo) addStriped(name string, dev DevInfo) {
+	for i := range f.Striped {
+		if f.Striped[i].Name == name {
+			f.Striped[i].Devs = append(f.Striped[i].Devs, dev)
+			return
+		}
+	}
+	f.Striped = append(f.Striped, DevGroup{Name: name, Devs: []DevInfo{dev}})
 }
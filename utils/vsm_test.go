@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMcfEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		mcf     string
+		entries []McfEntry
+		errs    []int // lines with errors
+	}{
+		{
+			name: "four fields",
+			mcf:  "/dev/sda 10 md samfs1\n",
+			entries: []McfEntry{
+				{Line: 1, Path: "/dev/sda", Ord: 10, Type: "md", FamilySet: "samfs1", State: "on"},
+			},
+		},
+		{
+			name: "five fields",
+			mcf:  "/dev/sda 10 md samfs1 off\n",
+			entries: []McfEntry{
+				{Line: 1, Path: "/dev/sda", Ord: 10, Type: "md", FamilySet: "samfs1", State: "off"},
+			},
+		},
+		{
+			name: "six fields",
+			mcf:  "samfs1 1 ms samfs1 on shared\n",
+			entries: []McfEntry{
+				{Line: 1, Path: "samfs1", Ord: 1, Type: "ms", FamilySet: "samfs1", State: "on", Params: "shared"},
+			},
+		},
+		{
+			name: "placeholders",
+			mcf:  "/dev/st0 50 li - - -\n",
+			entries: []McfEntry{
+				{Line: 1, Path: "/dev/st0", Ord: 50, Type: "li", State: "on"},
+			},
+		},
+		{
+			name: "comments and empty lines",
+			mcf:  "# samfs1\n\n   # indented\n/dev/sda 10 md samfs1 on # data\n/dev/sdb 11 md samfs1\t#data\n",
+			entries: []McfEntry{
+				{Line: 4, Path: "/dev/sda", Ord: 10, Type: "md", FamilySet: "samfs1", State: "on"},
+				{Line: 5, Path: "/dev/sdb", Ord: 11, Type: "md", FamilySet: "samfs1", State: "on"},
+			},
+		},
+		{
+			name: "hash inside a field",
+			mcf:  "/dev/disk/by-id/lun#3 10 md fs#1 on\n",
+			entries: []McfEntry{
+				{Line: 1, Path: "/dev/disk/by-id/lun#3", Ord: 10, Type: "md", FamilySet: "fs#1", State: "on"},
+			},
+		},
+		{
+			name: "striped groups",
+			mcf:  "/dev/sda 10 g0 samfs1\n/dev/sdb 11 g127 samfs1\n/dev/sdc 12 g128 samfs1\n",
+			entries: []McfEntry{
+				{Line: 1, Path: "/dev/sda", Ord: 10, Type: "g0", FamilySet: "samfs1", State: "on"},
+				{Line: 2, Path: "/dev/sdb", Ord: 11, Type: "g127", FamilySet: "samfs1", State: "on"},
+				{Line: 3, Path: "/dev/sdc", Ord: 12, Type: "g128", FamilySet: "samfs1", State: "on"},
+			},
+		},
+		{
+			name: "bad lines are skipped",
+			mcf:  "/dev/sda 10 md\n/dev/sdb 11 md samfs1\n/dev/sdc 12 md samfs1 on - extra\n/dev/sdd x md samfs1\n/dev/sde -1 md samfs1\n",
+			entries: []McfEntry{
+				{Line: 2, Path: "/dev/sdb", Ord: 11, Type: "md", FamilySet: "samfs1", State: "on"},
+			},
+			errs: []int{1, 3, 4, 5},
+		},
+	}
+
+	for _, tt := range tests {
+		entries, errs, err := parseMcfEntries(strings.NewReader(tt.mcf))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(entries, tt.entries) {
+			t.Errorf("%s: got entries %+v, want %+v", tt.name, entries, tt.entries)
+		}
+		var lines []int
+		for _, e := range errs {
+			lines = append(lines, e.Line)
+		}
+		if !reflect.DeepEqual(lines, tt.errs) {
+			t.Errorf("%s: got errors on lines %v, want %v", tt.name, lines, tt.errs)
+		}
+	}
+}
+
+func TestIsStripedType(t *testing.T) {
+	tests := map[string]bool{
+		"g0":   true,
+		"g1":   true,
+		"g127": true,
+		"g128": false,
+		"g":    false,
+		"gx":   false,
+		"md":   false,
+	}
+	for eqtype, want := range tests {
+		if got := IsStripedType(eqtype); got != want {
+			t.Errorf("IsStripedType(%q) = %v, want %v", eqtype, got, want)
+		}
+	}
+}
+
+func TestMcfFilesystems(t *testing.T) {
+	mcf := `samfs1 1 ma samfs1 on
+/dev/sda 10 mm samfs1
+/dev/sdb 11 g0 samfs1
+/dev/sdc 12 g0 samfs1
+/dev/sdd 13 g127 samfs1
+/dev/sde 14 g128 samfs1
+/dev/sdf 20 md samfs2
+`
+	entries, _, err := parseMcfEntries(strings.NewReader(mcf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fses, errs := mcfFilesystems(entries)
+	if len(fses) != 1 {
+		t.Fatalf("got %d filesystems, want 1", len(fses))
+	}
+
+	fs := fses[0]
+	if len(fs.MM) != 1 || fs.MM[0].Path != "/dev/sda" {
+		t.Errorf("got metadata devices %+v", fs.MM)
+	}
+	var groups []string
+	for _, g := range fs.Striped {
+		groups = append(groups, g.Name)
+	}
+	if !reflect.DeepEqual(groups, []string{"g0", "g127"}) {
+		t.Errorf("got striped groups %v, want [g0 g127]", groups)
+	}
+	if len(fs.Striped[0].Devs) != 2 {
+		t.Errorf("got %d devices in g0, want 2", len(fs.Striped[0].Devs))
+	}
+
+	// samfs2 is never defined
+	if len(errs) != 1 || errs[0].Line != 7 {
+		t.Errorf("got errors %v, want one on line 7", errs)
+	}
+}
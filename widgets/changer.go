@@ -0,0 +1,100 @@
+package widgets
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	ui "github.com/benmcclelland/termui"
+	"github.com/benmcclelland/vsmtop/utils"
+)
+
+type Changer struct {
+	*ui.Table
+	interval time.Duration
+
+	changers     []utils.Changer
+	countersprev map[string]int64
+	countersnew  map[string]int64
+	none         bool
+}
+
+func NewChanger() *Changer {
+	var none bool
+	changers, err := utils.FindChangers()
+	if err != nil || len(changers) == 0 {
+		none = true
+	}
+
+	self := &Changer{
+		Table:    ui.NewTable(),
+		interval: time.Second,
+		changers: changers,
+		none:     none,
+	}
+	self.Label = "Media Changers"
+	self.ColResizer = self.ColResize
+	self.ColWidths = []int{6, 20, 16, 8}
+	self.UniqueCol = 0
+	self.Header = []string{"DEV", "MODEL", "DRIVES", "ACTIVITY"}
+	self.SelectedRow = -1
+
+	self.update()
+
+	ticker := time.NewTicker(self.interval)
+	go func() {
+		for range ticker.C {
+			self.update()
+		}
+	}()
+
+	return self
+}
+
+func (self *Changer) update() {
+	if self.none {
+		self.Rows = make([][]string, 1)
+		self.Rows[0] = []string{"None", "", "", ""}
+		return
+	}
+
+	self.countersnew = make(map[string]int64, len(self.changers))
+	for _, c := range self.changers {
+		n, err := utils.ChangerRequests(c.Name)
+		if err != nil {
+			if debug {
+				log.Println(err)
+			}
+			continue
+		}
+		self.countersnew[c.Name] = n
+	}
+
+	self.Rows = make([][]string, len(self.changers))
+	for i, c := range self.changers {
+		self.Rows[i] = []string{
+			c.Name,
+			strings.TrimSpace(c.Vendor + " " + c.Model),
+			strings.Join(c.Drives, ","),
+			self.activity(c.Name),
+		}
+	}
+
+	self.countersprev = self.countersnew
+}
+
+// activity reports whether the changer was sent any commands since the last update
+func (self *Changer) activity(name string) string {
+	n, ok := self.countersnew[name]
+	if !ok {
+		return "-"
+	}
+	prev, ok := self.countersprev[name]
+	if !ok {
+		return "idle"
+	}
+	if n != prev {
+		return "active"
+	}
+	return "idle"
+}
@@ -1,3 +1,109 @@
 package widgets
 
+import (
+	"fmt"
+	"time"
+
+	ui "github.com/benmcclelland/termui"
+)
+
 var debug = false
+
+// colorRows redraws the foreground of the given table rows in another color.
+// It is called from the Buffer method of tables that highlight rows.
+func colorRows(table *ui.Table, buf *ui.Buffer, colors map[int]ui.Color) {
+	for rowNum, color := range colors {
+		if rowNum < table.TopRow || rowNum >= table.TopRow+table.Y-1 {
+			continue
+		}
+		y := (rowNum + 2) - table.TopRow
+		for x := 1; x <= table.X; x++ {
+			c := buf.At(x, y)
+			c.Fg = color
+			buf.SetCell(x, y, c)
+		}
+	}
+}
+
+// selectRow moves the cursor of a table to the given row, scrolling the table
+// if needed. termui only scrolls when moving the cursor, so step onto the row
+// from the one below it.
+func selectRow(table *ui.Table, row int) {
+	table.SelectedRow = row + 1
+	table.Up()
+}
+
+// headerColumn returns the column of the table header at the mouse position,
+// or -1 if the header wasn't clicked
+func headerColumn(table *ui.Table, x, y int) int {
+	x = x - table.XOffset
+	y = y - table.YOffset
+	if y != 1 || x <= 0 || x > table.X {
+		return -1
+	}
+	col := -1
+	for i, pos := range table.CellXPos {
+		if i >= len(table.ColWidths) || table.ColWidths[i] == 0 {
+			continue
+		}
+		if x >= pos {
+			col = i
+		}
+	}
+	return col
+}
+
+// tableSort is the column a table is sorted by. Each table decides which way
+// a column sorts first; reverse flips it.
+type tableSort struct {
+	col     int // -1 keeps the table's own order
+	reverse bool
+}
+
+// click sorts by col, or reverses the order if the table is already sorted
+// by col
+func (self *tableSort) click(col int) {
+	if col == self.col {
+		self.reverse = !self.reverse
+		return
+	}
+	self.col = col
+	self.reverse = false
+}
+
+// descending returns whether the sorted column is in descending order, given
+// whether the column sorts descending first
+func (self tableSort) descending(descFirst bool) bool {
+	return descFirst != self.reverse
+}
+
+// marker adds the sort direction to the header of the sorted column
+func (self tableSort) marker(header []string, desc bool) {
+	if self.col < 0 || self.col >= len(header) {
+		return
+	}
+	if desc {
+		header[self.col] += DOWN
+	} else {
+		header[self.col] += UP
+	}
+}
+
+// shortDuration formats a duration with its two largest units, such as
+// "3d2h" or "5m12s"
+func shortDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	days := int(d / (24 * time.Hour))
+	hours := int(d / time.Hour % 24)
+	mins := int(d / time.Minute % 60)
+	secs := int(d / time.Second % 60)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, mins)
+	case mins > 0:
+		return fmt.Sprintf("%dm%ds", mins, secs)
+	}
+	return fmt.Sprintf("%ds", secs)
+}
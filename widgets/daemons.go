@@ -0,0 +1,110 @@
+package widgets
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	ui "github.com/benmcclelland/termui"
+	"github.com/benmcclelland/vsmtop/utils"
+)
+
+// process names are cut to this many characters by the kernel
+const commLen = 15
+
+func commName(name string) string {
+	if len(name) > commLen {
+		return name[:commLen]
+	}
+	return name
+}
+
+// Daemons is a checklist of the VSM daemons the host should be running,
+// checked against the process list's scan.
+type Daemons struct {
+	*ui.Table
+	configured []string
+	expected   []string
+	watcher    *utils.McfWatcher
+	rowColors  map[int]ui.Color
+	AlertColor ui.Color
+
+	mu sync.Mutex
+}
+
+// NewDaemons creates the checklist of the given daemons and the ones the mcf
+// needs.
+func NewDaemons(daemons []string) *Daemons {
+	self := &Daemons{
+		Table:      ui.NewTable(),
+		configured: daemons,
+		expected:   utils.ExpectedDaemons(daemons),
+		watcher:    utils.NewMcfWatcher(),
+		AlertColor: ui.Theme.Fg,
+	}
+	self.Label = "VSM Daemons"
+	self.ColWidths = []int{14, 7, 4, 6}
+	self.UniqueCol = 0
+	self.Header = []string{"DAEMON", "STATE", "PIDS", "UP"}
+	self.SelectedRow = -1
+
+	for _, d := range self.expected {
+		self.Rows = append(self.Rows, []string{d, "", "", ""})
+	}
+
+	return self
+}
+
+// Update checks the expected daemons against every process found by a
+// scan. A daemon is missing as soon as a scan doesn't find it.
+func (self *Daemons) Update(procs []*utils.ProcStat) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.watcher.Changed() {
+		self.expected = utils.ExpectedDaemons(self.configured)
+	}
+
+	type running struct {
+		count   int
+		started time.Time
+	}
+	found := make(map[string]running, len(self.expected))
+	for _, d := range self.expected {
+		found[commName(d)] = running{}
+	}
+	for _, p := range procs {
+		r, ok := found[p.Name]
+		if !ok {
+			continue
+		}
+		r.count++
+		// the uptime is of the longest running process
+		if r.started.IsZero() || p.Started.Before(r.started) {
+			r.started = p.Started
+		}
+		found[p.Name] = r
+	}
+
+	self.Rows = make([][]string, len(self.expected))
+	self.rowColors = make(map[int]ui.Color)
+	for i, d := range self.expected {
+		r := found[commName(d)]
+		if r.count == 0 {
+			self.Rows[i] = []string{d, "missing", "0", "-"}
+			self.rowColors[i] = self.AlertColor
+			continue
+		}
+		self.Rows[i] = []string{d, "running", strconv.Itoa(r.count), shortDuration(time.Since(r.started))}
+	}
+}
+
+// Buffer implements the Bufferer interface and highlights missing daemons.
+func (self *Daemons) Buffer() *ui.Buffer {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	buf := self.Table.Buffer()
+	colorRows(self.Table, buf, self.rowColors)
+	return buf
+}
@@ -3,7 +3,11 @@ package widgets
 import (
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	ui "github.com/benmcclelland/termui"
@@ -17,47 +21,111 @@ type Disk struct {
 
 	infos        []utils.FsInfo
 	devs         []string
+	watcher      *utils.McfWatcher
+	bannerUntil  time.Time
+	tree         []*diskNode
+	expanded     map[string]bool
+	rowKeys      []string
+	rowColors    map[int]ui.Color
+	extended     bool
+	showAll      int
+	sort         tableSort
+	maxPaths     map[string]int
+	scsiprev     map[string]utils.ScsiCounters
+	scsinew      map[string]utils.ScsiCounters
+	lastErr      map[string]time.Time
 	KeyPressed   chan bool
+	DimColor     ui.Color
+	AlertColor   ui.Color
 	countersprev map[string]disk.IOCountersStat
 	countersnew  map[string]disk.IOCountersStat
 	none         bool
+
+	// synchronize simultaneous updates due to user keypressed
+	mu sync.Mutex
+}
+
+// diskNode is a row in the disk tree, either a family set, a group of
+// devices within a family set, or a single device.
+type diskNode struct {
+	key      string
+	name     string
+	path     string // mcf device path, only set for devices
+	dev      string // kernel device name, set for devices that are not in the mcf
+	state    string // mcf device state, only set for devices
+	children []*diskNode
 }
 
+// devStat is the activity of a device, or the sum of a group of devices,
+// over one update interval.
+type devStat struct {
+	wbytes   uint64
+	wcount   uint64
+	rbytes   uint64
+	rcount   uint64
+	wtime    uint64 // ms spent on writes
+	rtime    uint64 // ms spent on reads
+	weighted uint64 // ms spent on I/O weighted by the number of I/Os in flight
+	inflight uint64
+	util     uint64
+	alert    bool // new scsi errors
+}
+
+var (
+	diskHeader       = []string{"DEV", "STATE", "WBps", "WIOps", "RBps", "RIOps", "UTIL%"}
+	diskColWidths    = []int{10, 8, 5, 5, 5, 5, 5}
+	diskExtHeader    = []string{"RAWAIT", "WAWAIT", "AQU-SZ", "INFLT", "AREQ-SZ"}
+	diskExtColWidths = []int{6, 6, 6, 5, 7}
+)
+
+// which devices the Disk widget shows
+const (
+	diskShowMcf        = iota // only the mcf devices
+	diskShowAll               // every disk, excluding partitions, loop and ram devices
+	diskShowEverything        // every block device
+)
+
+const (
+	diskLabel = "Disk Usage"
+	// how long the label shows that the mcf was reloaded
+	bannerTime = 10 * time.Second
+	// how long a device stays highlighted after a scsi error
+	errHighlight = 30 * time.Second
+)
+
 func NewDisk(keyPressed chan bool) *Disk {
 	var none bool
-	f, err := utils.ParseMcf()
+	watcher := utils.NewMcfWatcher()
+	f, _, err := utils.ParseMcf()
 	if err != nil {
 		none = true
 	}
 
-	var devs []string
-	for _, fs := range f {
-		for _, d := range fs.MM {
-			devs = append(devs, d.Path)
-		}
-		for _, d := range fs.MR {
-			devs = append(devs, d.Path)
-		}
-		for _, d := range fs.MD {
-			devs = append(devs, d.Path)
-		}
-	}
-
 	self := &Disk{
 		Table:      ui.NewTable(),
 		interval:   time.Second,
 		infos:      f,
-		devs:       devs,
+		devs:       mcfDevs(f),
+		watcher:    watcher,
+		expanded:   make(map[string]bool),
+		maxPaths:   make(map[string]int),
+		scsinew:    make(map[string]utils.ScsiCounters),
+		lastErr:    make(map[string]time.Time),
 		KeyPressed: keyPressed,
+		DimColor:   ui.Theme.Fg,
+		AlertColor: ui.Theme.Fg,
+		sort:       tableSort{col: -1},
 		none:       none,
 	}
-	self.Label = "Disk Usage"
+	self.Label = diskLabel
+	self.expanded["vsm"] = true
+	self.expanded["other"] = true
 	self.ColResizer = self.ColResize
-	self.ColWidths = []int{10, 5, 5, 5, 5, 5}
 	self.UniqueCol = 0
-	self.Header = []string{"DEV", "WBps", "WIOps", "RBps", "RIOps", "UTIL%"}
 	self.SelectedRow = -1
+	self.setColumns()
 
+	self.buildTree()
 	self.update()
 
 	ticker := time.NewTicker(self.interval)
@@ -70,85 +138,684 @@ func NewDisk(keyPressed chan bool) *Disk {
 	return self
 }
 
+// buildTree builds the family set -> device group -> device tree from the mcf,
+// with each striped group as a device group of its own. Family sets start out
+// collapsed so that large filesystems only take up a single row until expanded.
+func (self *Disk) buildTree() {
+	self.tree = nil
+	for _, fs := range self.infos {
+		fsNode := &diskNode{key: fs.Name, name: fs.Name}
+		groups := []utils.DevGroup{
+			{Name: "mm", Devs: fs.MM},
+			{Name: "mr", Devs: fs.MR},
+			{Name: "md", Devs: fs.MD},
+		}
+		groups = append(groups, fs.Striped...)
+		for _, g := range groups {
+			if len(g.Devs) == 0 {
+				continue
+			}
+			groupNode := &diskNode{key: fs.Name + "/" + g.Name, name: g.Name}
+			for _, d := range g.Devs {
+				groupNode.children = append(groupNode.children, &diskNode{
+					key:   groupNode.key + "/" + d.Path,
+					name:  filepath.Base(d.Path),
+					path:  d.Path,
+					state: d.State,
+				})
+			}
+			if _, ok := self.expanded[groupNode.key]; !ok {
+				self.expanded[groupNode.key] = true
+			}
+			fsNode.children = append(fsNode.children, groupNode)
+		}
+		self.tree = append(self.tree, fsNode)
+	}
+}
+
+// mcfDevs returns the path of every device in the mcf filesystems
+func mcfDevs(fses []utils.FsInfo) []string {
+	var devs []string
+	for _, fs := range fses {
+		for _, d := range fs.Devices() {
+			devs = append(devs, d.Path)
+		}
+	}
+	return devs
+}
+
+// reload rebuilds the disk tree in place when the mcf has changed. The
+// counters are kept so that rates carry on across the reload.
+func (self *Disk) reload() {
+	if !self.bannerUntil.IsZero() && time.Now().After(self.bannerUntil) {
+		self.Label = diskLabel
+		self.bannerUntil = time.Time{}
+	}
+
+	if !self.watcher.Changed() {
+		return
+	}
+
+	f, errs, err := utils.ParseMcf()
+	if err != nil {
+		self.banner(fmt.Sprintf("mcf reload failed: %v", err))
+		return
+	}
+
+	devs := mcfDevs(f)
+	added, removed := diffDevs(self.devs, devs)
+
+	self.infos = f
+	self.devs = devs
+	self.none = false
+	self.buildTree()
+
+	if len(errs) > 0 {
+		self.banner(fmt.Sprintf("mcf reloaded: %d added, %d removed, %v", added, removed, errs[0]))
+		return
+	}
+	self.banner(fmt.Sprintf("mcf reloaded: %d added, %d removed", added, removed))
+}
+
+func (self *Disk) banner(msg string) {
+	self.Label = diskLabel + " - " + msg
+	self.bannerUntil = time.Now().Add(bannerTime)
+}
+
+// diffDevs returns the number of devices added and removed going from prev to cur
+func diffDevs(prev, cur []string) (int, int) {
+	old := make(map[string]bool, len(prev))
+	for _, d := range prev {
+		old[d] = true
+	}
+	added := 0
+	for _, d := range cur {
+		if old[d] {
+			delete(old, d)
+			continue
+		}
+		added++
+	}
+	return added, len(old)
+}
+
 func (self *Disk) update() {
-	if self.none {
-		self.Rows = make([][]string, 1)
-		self.Rows[0] = []string{"None", "", "", "", "", ""}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.reload()
+
+	if self.none && self.showAll == diskShowMcf {
+		self.Rows = [][]string{self.blankRow("None")}
 		return
 	}
 
-	var err error
-	self.countersnew, err = disk.IOCounters()
+	counters, err := disk.IOCounters()
 	if err != nil {
 		if debug {
 			log.Println(err)
 		}
 		return
 	}
+	self.countersprev = self.countersnew
+	self.countersnew = counters
+	self.scsiprev = self.scsinew
+	self.scsinew = make(map[string]utils.ScsiCounters)
 
 	if self.countersprev == nil {
-		self.countersprev = self.countersnew
 		return
 	}
 
-	self.Rows = nil
-	for _, fs := range self.infos {
-		self.Rows = append(self.Rows, []string{fs.Name, "", "", "", "", "", ""})
-		if len(fs.MM) > 0 {
-			self.Rows = append(self.Rows, []string{" mm", "", "", "", "", "", ""})
-			for _, d := range fs.MM {
-				self.Rows = append(self.Rows, self.updateDev("  "+filepath.Base(d.Path), filepath.Base(realPath(d.Path))))
+	self.updateRows()
+}
+
+// diskRows collects the table rows, the tree key of each row, and the rows
+// that are drawn in a color other than the default
+type diskRows struct {
+	rows   [][]string
+	keys   []string
+	colors map[int]ui.Color
+}
+
+// updateRows rebuilds the table from the last two sets of counters
+func (self *Disk) updateRows() {
+	nodes := self.tree
+	if self.showAll != diskShowMcf {
+		nodes = []*diskNode{
+			{key: "vsm", name: "VSM (mcf)", children: self.tree},
+			{key: "other", name: "Other", children: self.otherNodes()},
+		}
+	}
+
+	r := diskRows{colors: make(map[int]ui.Color)}
+	self.addNodes(&r, nodes, 0, true, true)
+	self.Rows = r.rows
+	self.rowKeys = r.keys
+	self.rowColors = r.colors
+}
+
+// addNode adds the row for a node, followed by its children if the node is
+// expanded. The stats of a node with children are the sum of its children.
+func (self *Disk) addNode(r *diskRows, node *diskNode, depth int, visible bool) devStat {
+	i := len(r.rows)
+	if visible {
+		r.rows = append(r.rows, nil)
+		r.keys = append(r.keys, node.key)
+	}
+
+	name := strings.Repeat(" ", depth) + self.marker(node) + node.name
+
+	if node.dev != "" {
+		return self.addDev(r, i, node, node.dev, "", depth, visible)
+	}
+
+	if node.path != "" {
+		// devices that vsm is not using are not polled
+		if offline(node.state) {
+			if visible {
+				r.rows[i] = self.blankRow(name)
+				r.rows[i][1] = node.state
+				r.colors[i] = self.DimColor
 			}
+			return devStat{}
 		}
-		if len(fs.MR) > 0 {
-			self.Rows = append(self.Rows, []string{" mr", "", "", "", "", "", ""})
-			for _, d := range fs.MR {
-				self.Rows = append(self.Rows, self.updateDev("  "+filepath.Base(d.Path), filepath.Base(realPath(d.Path))))
+		dev, err := realPath(node.path)
+		if err != nil {
+			if visible {
+				r.rows[i] = self.blankRow(name)
+				r.rows[i][1] = "MISSING"
+			}
+			return devStat{}
+		}
+		return self.addDev(r, i, node, filepath.Base(dev), node.state, depth, visible)
+	}
+
+	st := self.addNodes(r, node.children, depth+1, visible && self.expanded[node.key], false)
+	if visible {
+		r.rows[i] = st.row(name, "", self.extended)
+		if st.alert {
+			r.colors[i] = self.AlertColor
+		}
+	}
+	return st
+}
+
+// addNodes adds the rows of sibling nodes in the sort order, optionally
+// with a blank row after each, and returns their summed stats
+func (self *Disk) addNodes(r *diskRows, nodes []*diskNode, depth int, visible, sep bool) devStat {
+	type sibling struct {
+		node *diskNode
+		rows diskRows
+		st   devStat
+	}
+	siblings := make([]sibling, len(nodes))
+	var st devStat
+	for i, node := range nodes {
+		siblings[i].node = node
+		siblings[i].rows = diskRows{colors: make(map[int]ui.Color)}
+		siblings[i].st = self.addNode(&siblings[i].rows, node, depth, visible)
+		st.add(siblings[i].st)
+	}
+
+	if visible && self.sort.col >= 0 {
+		// names and states sort alphabetically, everything else starts
+		// with the busiest device
+		col := self.sort.col
+		desc := self.sort.descending(col > 1)
+		sort.SliceStable(siblings, func(i, j int) bool {
+			a, b := siblings[i], siblings[j]
+			if desc {
+				a, b = b, a
+			}
+			switch col {
+			case 0:
+				return a.node.name < b.node.name
+			case 1:
+				return a.rows.rows[0][1] < b.rows.rows[0][1]
 			}
+			return a.st.value(col) < b.st.value(col)
+		})
+	}
+
+	for _, s := range siblings {
+		for i, color := range s.rows.colors {
+			r.colors[len(r.rows)+i] = color
+		}
+		r.rows = append(r.rows, s.rows.rows...)
+		r.keys = append(r.keys, s.rows.keys...)
+		if visible && sep {
+			r.rows = append(r.rows, self.blankRow(""))
+			r.keys = append(r.keys, "")
 		}
-		if len(fs.MD) > 0 {
-			self.Rows = append(self.Rows, []string{" md", "", "", "", "", "", ""})
-			for _, d := range fs.MD {
-				self.Rows = append(self.Rows, self.updateDev("  "+filepath.Base(d.Path), filepath.Base(realPath(d.Path))))
+	}
+	return st
+}
+
+// addDev fills in the row of a device. Device-mapper devices can be expanded
+// to show a row for each of the paths below them.
+func (self *Disk) addDev(r *diskRows, i int, node *diskNode, dev, state string, depth int, visible bool) devStat {
+	st := self.devStat(dev)
+
+	// the scsi devices behind dev, which are its paths if it is a
+	// device-mapper device
+	slaves := utils.DmSlaves(dev)
+	paths := slaves
+	if len(paths) == 0 {
+		paths = []string{dev}
+	}
+	for _, p := range paths {
+		if self.newErrors(p) {
+			st.alert = true
+		}
+	}
+	if self.degraded(dev, slaves) {
+		state = "DEGRADED"
+	}
+	if !visible {
+		return st
+	}
+
+	marker := "+"
+	if self.expanded[node.key] {
+		marker = "-"
+	}
+	r.rows[i] = st.row(strings.Repeat(" ", depth)+marker+node.name, state, self.extended)
+	if st.alert {
+		r.colors[i] = self.AlertColor
+	}
+
+	if !self.expanded[node.key] {
+		return st
+	}
+	indent := strings.Repeat(" ", depth+2)
+	for _, p := range paths {
+		key := node.key + "/" + p
+		if len(slaves) > 0 {
+			if self.newErrors(p) {
+				r.colors[len(r.rows)] = self.AlertColor
 			}
+			r.rows = append(r.rows, self.devStat(p).row(indent+p, utils.PathState(p), self.extended))
+			r.keys = append(r.keys, key)
+		}
+		if c, ok := self.scsinew[p]; ok {
+			r.rows = append(r.rows, self.blankRow(fmt.Sprintf("%s  ioerr %d iodone %d ioreq %d blocked %d",
+				indent, c.IoErr, c.IoDone, c.IoRequest, c.Blocked)))
+			r.keys = append(r.keys, key+"/scsi")
 		}
-		self.Rows = append(self.Rows, []string{"", "", "", "", "", "", ""})
 	}
+	return st
+}
 
-	self.countersprev = self.countersnew
+// newErrors returns true if the scsi error count of dev has gone up within
+// the last errHighlight
+func (self *Disk) newErrors(dev string) bool {
+	if _, ok := self.scsinew[dev]; !ok {
+		c, err := utils.BlockScsiCounters(dev)
+		if err != nil {
+			return false
+		}
+		self.scsinew[dev] = c
+		if prev, ok := self.scsiprev[dev]; ok && c.IoErr > prev.IoErr {
+			self.lastErr[dev] = time.Now()
+		}
+	}
+	t, ok := self.lastErr[dev]
+	return ok && time.Since(t) < errHighlight
+}
+
+// degraded returns true if a multipath device has fewer paths than it has
+// had before, or if any of its paths are not running.
+func (self *Disk) degraded(dev string, slaves []string) bool {
+	if len(slaves) == 0 || !utils.IsMultipath(dev) {
+		return false
+	}
+
+	if len(slaves) > self.maxPaths[dev] {
+		self.maxPaths[dev] = len(slaves)
+	}
+	if len(slaves) < self.maxPaths[dev] {
+		return true
+	}
+
+	for _, slave := range slaves {
+		state := utils.PathState(slave)
+		if state != "" && state != "running" {
+			return true
+		}
+	}
+	return false
+}
+
+// offline returns true for the mcf device states where vsm is not using the device
+func offline(state string) bool {
+	return state == "off" || state == "down"
+}
+
+// otherNodes returns a device node for each block device not in the mcf.
+// The paths below a multipath mcf device are already shown under it.
+func (self *Disk) otherNodes() []*diskNode {
+	mcf := make(map[string]bool, len(self.devs))
+	for _, d := range self.devs {
+		dev, err := realPath(d)
+		if err != nil {
+			continue
+		}
+		name := filepath.Base(dev)
+		mcf[name] = true
+		for _, slave := range utils.DmSlaves(name) {
+			mcf[slave] = true
+		}
+	}
+
+	var names []string
+	for name := range self.countersnew {
+		if mcf[name] {
+			continue
+		}
+		if self.showAll == diskShowAll && hiddenDev(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	nodes := make([]*diskNode, len(names))
+	for i, name := range names {
+		nodes[i] = &diskNode{key: "other/" + name, name: name, dev: name}
+	}
+	return nodes
+}
+
+// hiddenDev returns true for partitions, loop and ram devices
+func hiddenDev(name string) bool {
+	if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+		return true
+	}
+	// only whole disks are listed in /sys/block, which uses ! in place of /
+	_, err := os.Stat(filepath.Join(utils.SYSBLOCKPATH, strings.Replace(name, "/", "!", -1)))
+	return err != nil
+}
+
+// ToggleAll cycles between showing the mcf devices, every disk, and every
+// block device including partitions, loop and ram devices.
+func (self *Disk) ToggleAll() {
+	self.mu.Lock()
+	self.showAll = (self.showAll + 1) % (diskShowEverything + 1)
+	self.refresh()
+	self.mu.Unlock()
+}
+
+// marker shows whether a node can be expanded or collapsed
+func (self *Disk) marker(node *diskNode) string {
+	if node.path != "" || node.dev != "" {
+		return " "
+	}
+	if self.expanded[node.key] {
+		return "-"
+	}
+	return "+"
+}
+
+// Toggle expands or collapses the selected family set, device group or device.
+func (self *Disk) Toggle() {
+	self.mu.Lock()
+	if self.SelectedRow >= 0 && self.SelectedRow < len(self.rowKeys) {
+		key := self.rowKeys[self.SelectedRow]
+		if key != "" {
+			self.expanded[key] = !self.expanded[key]
+		}
+	}
+	self.refresh()
+	self.mu.Unlock()
+}
+
+// Select moves the cursor to the device with the given name, expanding the
+// family set and device group it is in. It returns false if the device isn't
+// in the table.
+func (self *Disk) Select(name string) bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	var keys []string
+	for _, node := range self.tree {
+		if keys = findNode(node, name); keys != nil {
+			break
+		}
+	}
+	if keys == nil {
+		return false
+	}
+	if self.showAll != diskShowMcf {
+		keys = append([]string{"vsm"}, keys...)
+	}
+	// expand the ancestors but leave the device itself as it was
+	for _, key := range keys[:len(keys)-1] {
+		self.expanded[key] = true
+	}
+	self.refresh()
+
+	for i, key := range self.rowKeys {
+		if key == keys[len(keys)-1] {
+			selectRow(self.Table, i)
+			return true
+		}
+	}
+	return false
+}
+
+// findNode returns the keys of the nodes from node down to the device with
+// the given name, or nil if it isn't below node
+func findNode(node *diskNode, name string) []string {
+	if node.path != "" && node.name == name {
+		return []string{node.key}
+	}
+	for _, child := range node.children {
+		if keys := findNode(child, name); keys != nil {
+			return append([]string{node.key}, keys...)
+		}
+	}
+	return nil
+}
+
+// ToggleExtended shows or hides the latency, queue and request size columns.
+func (self *Disk) ToggleExtended() {
+	self.mu.Lock()
+	self.extended = !self.extended
+	self.setColumns()
+	self.refresh()
+	self.mu.Unlock()
+}
+
+// refresh rebuilds the rows after a display setting has changed
+func (self *Disk) refresh() {
+	switch {
+	case self.none && self.showAll == diskShowMcf:
+		self.Rows = [][]string{self.blankRow("None")}
+	case self.countersprev != nil:
+		self.updateRows()
+	default:
+		self.Rows = nil
+	}
+}
+
+func (self *Disk) setColumns() {
+	self.Header = append([]string{}, diskHeader...)
+	self.ColWidths = append([]int{}, diskColWidths...)
+	if self.extended {
+		self.Header = append(self.Header, diskExtHeader...)
+		self.ColWidths = append(self.ColWidths, diskExtColWidths...)
+	} else if self.sort.col >= len(self.Header) {
+		self.sort = tableSort{col: -1}
+	}
+	self.sort.marker(self.Header, self.sort.descending(self.sort.col > 1))
 }
 
-func (self *Disk) updateDev(name, dev string) []string {
-	//utils.Error("disk data",
-	//	fmt.Sprint(
-	//		"name: ", name, "\n",
-	//		"dev: ", dev, "\n",
-	//		"self.countersnew: ", self.countersnew, "\n",
-	//	))
+func (self *Disk) blankRow(name string) []string {
+	s := make([]string, len(self.Header))
+	s[0] = name
+	return s
+}
 
-	s := make([]string, 6)
+// ColResize overrides the default ColResize in the termui table so that the
+// column positions are recalculated when the extended columns are toggled.
+func (self *Disk) ColResize() {
+	self.Gap = 3
+	if self.X < 50 {
+		self.Gap = 1
+	} else if self.X < 75 {
+		self.Gap = 2
+	}
+
+	self.CellXPos = make([]int, len(self.ColWidths))
+	cur := 0
+	for i, w := range self.ColWidths {
+		cur += self.Gap
+		self.CellXPos[i] = cur
+		cur += w
+	}
+}
 
-	diff := self.countersnew[dev].IoTime - self.countersprev[dev].IoTime
-	util := diff / 10
+func (self *Disk) devStat(dev string) devStat {
+	prev := self.countersprev[dev]
+	new := self.countersnew[dev]
 
-	wbps := rate(self.countersprev[dev].WriteBytes, self.countersnew[dev].WriteBytes, true)
-	wiops := rate(self.countersprev[dev].WriteCount, self.countersnew[dev].WriteCount, false)
-	rbps := rate(self.countersprev[dev].ReadBytes, self.countersnew[dev].ReadBytes, true)
-	riops := rate(self.countersprev[dev].ReadCount, self.countersnew[dev].ReadCount, false)
+	diff := new.IoTime - prev.IoTime
+
+	return devStat{
+		wbytes:   new.WriteBytes - prev.WriteBytes,
+		wcount:   new.WriteCount - prev.WriteCount,
+		rbytes:   new.ReadBytes - prev.ReadBytes,
+		rcount:   new.ReadCount - prev.ReadCount,
+		wtime:    new.WriteTime - prev.WriteTime,
+		rtime:    new.ReadTime - prev.ReadTime,
+		weighted: new.WeightedIO - prev.WeightedIO,
+		inflight: new.IopsInProgress,
+		util:     diff / 10,
+	}
+}
+
+// add sums the counters of another device and keeps the highest utilization
+func (self *devStat) add(o devStat) {
+	self.wbytes += o.wbytes
+	self.wcount += o.wcount
+	self.rbytes += o.rbytes
+	self.rcount += o.rcount
+	self.wtime += o.wtime
+	self.rtime += o.rtime
+	self.weighted += o.weighted
+	self.inflight += o.inflight
+	if o.util > self.util {
+		self.util = o.util
+	}
+	self.alert = self.alert || o.alert
+}
+
+func (self devStat) row(name, state string, extended bool) []string {
+	s := make([]string, 7, 12)
 
 	s[0] = name
-	s[1] = wbps
-	s[2] = wiops
-	s[3] = rbps
-	s[4] = riops
-	s[5] = fmt.Sprintf("%v", util)
+	s[1] = state
+	s[2] = rate(0, self.wbytes, true)
+	s[3] = rate(0, self.wcount, false)
+	s[4] = rate(0, self.rbytes, true)
+	s[5] = rate(0, self.rcount, false)
+	s[6] = fmt.Sprintf("%v", self.util)
+
+	if extended {
+		s = append(s,
+			fmt.Sprintf("%6.2f", self.rawait()),
+			fmt.Sprintf("%6.2f", self.wawait()),
+			fmt.Sprintf("%6.2f", self.aqusz()),
+			fmt.Sprintf("%5d", self.inflight),
+			rate(0, self.reqsz(), true),
+		)
+	}
 
 	return s
 }
 
+func (self devStat) rawait() float64 {
+	if self.rcount == 0 {
+		return 0
+	}
+	return float64(self.rtime) / float64(self.rcount)
+}
+
+func (self devStat) wawait() float64 {
+	if self.wcount == 0 {
+		return 0
+	}
+	return float64(self.wtime) / float64(self.wcount)
+}
+
+// aqusz is the average queue size. Weighted I/O time is in ms, so over a one
+// second interval dividing by 1000 gives the queue size.
+func (self devStat) aqusz() float64 {
+	return float64(self.weighted) / 1000
+}
+
+func (self devStat) reqsz() uint64 {
+	if self.rcount+self.wcount == 0 {
+		return 0
+	}
+	return (self.rbytes + self.wbytes) / (self.rcount + self.wcount)
+}
+
+// value returns the number shown in a numeric column, for sorting
+func (self devStat) value(col int) float64 {
+	switch col {
+	case 2:
+		return float64(self.wbytes)
+	case 3:
+		return float64(self.wcount)
+	case 4:
+		return float64(self.rbytes)
+	case 5:
+		return float64(self.rcount)
+	case 6:
+		return float64(self.util)
+	case 7:
+		return self.rawait()
+	case 8:
+		return self.wawait()
+	case 9:
+		return self.aqusz()
+	case 10:
+		return float64(self.inflight)
+	case 11:
+		return float64(self.reqsz())
+	}
+	return 0
+}
+
+// Buffer implements the Bufferer interface and recolors the rows of devices
+// that are offline.
+func (self *Disk) Buffer() *ui.Buffer {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	buf := self.Table.Buffer()
+	colorRows(self.Table, buf, self.rowColors)
+	return buf
+}
+
+// SortBy sorts each level of the tree by a column, reversing the order if
+// it is already sorted by that column.
+func (self *Disk) SortBy(col int) {
+	self.mu.Lock()
+	self.sort.click(col)
+	self.setColumns()
+	self.refresh()
+	self.mu.Unlock()
+}
+
 func (self *Disk) ForeGround() {
 	ui.On("<MouseLeft>", func(e ui.Event) {
-		self.Click(e.MouseX, e.MouseY)
+		if col := headerColumn(self.Table, e.MouseX, e.MouseY); col >= 0 {
+			self.SortBy(col)
+		} else {
+			self.Click(e.MouseX, e.MouseY)
+		}
 		self.KeyPressed <- true
 	})
 
@@ -194,26 +861,38 @@ func (self *Disk) ForeGround() {
 		}
 		self.KeyPressed <- true
 	})
+
+	ui.On("<enter>", "<space>", func(e ui.Event) {
+		self.Toggle()
+		self.KeyPressed <- true
+	})
+
+	ui.On("x", func(e ui.Event) {
+		self.ToggleExtended()
+		self.KeyPressed <- true
+	})
+
+	ui.On("a", func(e ui.Event) {
+		self.ToggleAll()
+		self.KeyPressed <- true
+	})
 }
 
 func (self *Disk) BackGround() {
 	events := []string{
 		"<MouseLeft>", "<MouseWheelUp>", "<MouseWheelDown>", "<up>", "<down>",
 		"j", "k", "gg", "G", "<C-d>", "<C-u>", "<C-f>", "<C-b>",
+		"<enter>", "<space>", "x", "a",
 	}
 	ui.Off(events)
 }
 
-func realPath(path string) string {
+func realPath(path string) (string, error) {
 	e, err := filepath.EvalSymlinks(path)
 	if err != nil {
-		panic(err)
-	}
-	r, err := filepath.Abs(e)
-	if err != nil {
-		panic(err)
+		return "", err
 	}
-	return r
+	return filepath.Abs(e)
 }
 
 func rate(prev, new uint64, units bool) string {
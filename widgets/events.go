@@ -0,0 +1,288 @@
+package widgets
+
+import (
+	"log"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	ui "github.com/benmcclelland/termui"
+	"github.com/benmcclelland/vsmtop/utils"
+)
+
+var (
+	// kernel messages about tapes, changers, disks, scsi, multipath and fc:
+	// the ones that start with the driver or subsystem that logged them, and
+	// block layer I/O errors naming the device. A syslog timestamp may come
+	// first.
+	storageRxp = regexp.MustCompile(`^(\[\s*\d+\.\d+\]\s*)?((sd|st|sg|ch|scsi) \d+:\d+:\d+:\d+: |scsi host\d+: |(n?st\d+|sch\d+|sg\d+): |(qla\w*|lpfc|mpt\w*|fc_\w+|scsi_transport_fc)[ :\[]|rport-\d+:\d+-\d+: |device-mapper: multipath|.*\bI/O error,? (on )?dev (sd[a-z]+|n?st\d+|dm-\d+)\b)`)
+	// kernel device names that can be tied to a tape or mcf device
+	kernDevRxp = regexp.MustCompile(`\b(n?st\d+|sch\d+|sd[a-z]+|dm-\d+)\b`)
+)
+
+const (
+	EVENTSMAX = 500
+	// events that aren't from the kernel log are kept apart, so that they
+	// can't push out the kernel messages
+	OTHEREVENTSMAX = 100
+
+	// widgets that an event can jump to
+	TargetTape = "tape"
+	TargetDisk = "disk"
+)
+
+// event is a kernel log message tagged with the device it is about
+type event struct {
+	time   time.Time
+	dev    string
+	target string
+	msg    string
+}
+
+type Events struct {
+	*ui.Table
+	interval time.Duration
+
+	events     []event // from the kernel log
+	others     []event // added with Add
+	rowEvents  []event
+	devices    map[string]event // kernel name to device tag
+	watcher    *utils.McfWatcher
+	KeyPressed chan bool
+	// Jump is called with the target widget and device name of the
+	// selected event
+	Jump func(target, dev string)
+	none bool
+
+	mu sync.Mutex
+}
+
+func NewEvents(keyPressed chan bool) *Events {
+	self := &Events{
+		Table:      ui.NewTable(),
+		interval:   time.Second,
+		watcher:    utils.NewMcfWatcher(),
+		KeyPressed: keyPressed,
+	}
+	self.Label = "Storage Events"
+	self.ColResizer = self.ColResize
+	self.ColWidths = []int{8, 8, 60}
+	self.UniqueCol = 2
+	self.Header = []string{"TIME", "DEV", "MESSAGE"}
+	self.SelectedRow = -1
+
+	self.findDevices()
+
+	kernEvents := make(chan utils.KernelEvent, 100)
+	go func() {
+		err := utils.TailKernelLog(kernEvents)
+		if err != nil {
+			if debug {
+				log.Println(err)
+			}
+			self.mu.Lock()
+			self.none = true
+			self.mu.Unlock()
+		}
+	}()
+	go func() {
+		for e := range kernEvents {
+			self.add(e)
+		}
+	}()
+
+	self.update()
+
+	ticker := time.NewTicker(self.interval)
+	go func() {
+		for range ticker.C {
+			self.update()
+		}
+	}()
+
+	return self
+}
+
+// findDevices maps the kernel names of the tape drives, changers and mcf
+// devices, including the paths of multipath devices, to the names shown in
+// the Tape and Disk widgets.
+func (self *Events) findDevices() {
+	devices := make(map[string]event)
+
+	drives, _ := utils.FindDevices()
+	for _, drive := range drives {
+		devices[drive] = event{dev: drive, target: TargetTape}
+		devices["n"+drive] = event{dev: drive, target: TargetTape}
+	}
+	changers, _ := utils.FindChangers()
+	for _, c := range changers {
+		devices[c.Name] = event{dev: c.Name}
+	}
+
+	fses, _, _ := utils.ParseMcf()
+	for _, fs := range fses {
+		for _, d := range fs.Devices() {
+			dev, err := realPath(d.Path)
+			if err != nil {
+				continue
+			}
+			tag := event{dev: filepath.Base(d.Path), target: TargetDisk}
+			devices[filepath.Base(dev)] = tag
+			for _, p := range utils.DmSlaves(filepath.Base(dev)) {
+				devices[p] = tag
+			}
+		}
+	}
+
+	self.mu.Lock()
+	self.devices = devices
+	self.mu.Unlock()
+}
+
+// add keeps a kernel message if it is about storage, tagging it with the
+// tape or mcf device it names
+func (self *Events) add(e utils.KernelEvent) {
+	if !storageRxp.MatchString(e.Msg) {
+		return
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	ev := event{time: e.Time, msg: e.Msg}
+	for _, name := range kernDevRxp.FindAllString(e.Msg, -1) {
+		if tag, ok := self.devices[name]; ok {
+			ev.dev = tag.dev
+			ev.target = tag.target
+			break
+		}
+	}
+
+	self.events = append(self.events, ev)
+	if len(self.events) > EVENTSMAX {
+		self.events = self.events[len(self.events)-EVENTSMAX:]
+	}
+}
+
+// Add adds an event that isn't from the kernel log, such as a VSM daemon
+// exiting
+func (self *Events) Add(t time.Time, msg string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.others = append(self.others, event{time: t, msg: msg})
+	if len(self.others) > OTHEREVENTSMAX {
+		self.others = self.others[len(self.others)-OTHEREVENTSMAX:]
+	}
+}
+
+func (self *Events) update() {
+	if self.watcher.Changed() {
+		self.findDevices()
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.none && len(self.events) == 0 && len(self.others) == 0 {
+		self.Rows = [][]string{{"", "", "kernel log not readable"}}
+		self.rowEvents = nil
+		return
+	}
+
+	// newest first, merging the kernel and other events
+	n := len(self.events) + len(self.others)
+	self.Rows = make([][]string, n)
+	self.rowEvents = make([]event, n)
+	k, o := len(self.events)-1, len(self.others)-1
+	for i := 0; i < n; i++ {
+		var e event
+		if o < 0 || k >= 0 && !self.events[k].time.Before(self.others[o].time) {
+			e = self.events[k]
+			k--
+		} else {
+			e = self.others[o]
+			o--
+		}
+		self.Rows[i] = []string{e.time.Format("15:04:05"), e.dev, e.msg}
+		self.rowEvents[i] = e
+	}
+}
+
+// JumpToDevice calls Jump with the device of the selected event.
+func (self *Events) JumpToDevice() {
+	self.mu.Lock()
+	var e event
+	if self.SelectedRow >= 0 && self.SelectedRow < len(self.rowEvents) {
+		e = self.rowEvents[self.SelectedRow]
+	}
+	self.mu.Unlock()
+
+	if e.target != "" && self.Jump != nil {
+		self.Jump(e.target, e.dev)
+	}
+}
+
+func (self *Events) ForeGround() {
+	ui.On("<MouseLeft>", func(e ui.Event) {
+		self.Click(e.MouseX, e.MouseY)
+		self.KeyPressed <- true
+	})
+
+	ui.On("<MouseWheelUp>", "<MouseWheelDown>", func(e ui.Event) {
+		switch e.Key {
+		case "<MouseWheelDown>":
+			self.Down()
+		case "<MouseWheelUp>":
+			self.Up()
+		}
+		self.KeyPressed <- true
+	})
+
+	ui.On("<up>", "<down>", func(e ui.Event) {
+		switch e.Key {
+		case "<up>":
+			self.Up()
+		case "<down>":
+			self.Down()
+		}
+		self.KeyPressed <- true
+	})
+
+	viKeys := []string{"j", "k", "gg", "G", "<C-d>", "<C-u>", "<C-f>", "<C-b>"}
+	ui.On(viKeys, func(e ui.Event) {
+		switch e.Key {
+		case "j":
+			self.Down()
+		case "k":
+			self.Up()
+		case "gg":
+			self.Top()
+		case "G":
+			self.Bottom()
+		case "<C-d>":
+			self.HalfPageDown()
+		case "<C-u>":
+			self.HalfPageUp()
+		case "<C-f>":
+			self.PageDown()
+		case "<C-b>":
+			self.PageUp()
+		}
+		self.KeyPressed <- true
+	})
+
+	ui.On("<enter>", func(e ui.Event) {
+		self.JumpToDevice()
+	})
+}
+
+func (self *Events) BackGround() {
+	events := []string{
+		"<MouseLeft>", "<MouseWheelUp>", "<MouseWheelDown>", "<up>", "<down>",
+		"j", "k", "gg", "G", "<C-d>", "<C-u>", "<C-f>", "<C-b>",
+		"<enter>",
+	}
+	ui.Off(events)
+}
@@ -0,0 +1,187 @@
+package widgets
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ui "github.com/benmcclelland/termui"
+	"github.com/benmcclelland/vsmtop/utils"
+)
+
+type FC struct {
+	*ui.Table
+	interval time.Duration
+
+	hosts        []string
+	devices      map[string][]string
+	watcher      *utils.McfWatcher
+	countersprev map[string]utils.FcHost
+	countersnew  map[string]utils.FcHost
+	none         bool
+}
+
+func NewFC() *FC {
+	var none bool
+	hosts, err := utils.FindFcHosts()
+	if err != nil || len(hosts) == 0 {
+		none = true
+	}
+
+	self := &FC{
+		Table:    ui.NewTable(),
+		interval: time.Second,
+		hosts:    hosts,
+		watcher:  utils.NewMcfWatcher(),
+		none:     none,
+	}
+	self.Label = "FC Host Ports"
+	self.ColResizer = self.ColResize
+	self.ColWidths = []int{6, 18, 8, 7, 7, 7, 7, 7, 5, 4, 4, 5, 20}
+	self.UniqueCol = 0
+	self.Header = []string{"HOST", "PORT", "STATE", "SPEED", "TxFps", "RxFps", "TxBps", "RxBps", "LinkF", "Sync", "CRC", "ErrFr", "DEVICES"}
+	self.SelectedRow = -1
+
+	self.findDevices()
+	self.update()
+
+	ticker := time.NewTicker(self.interval)
+	go func() {
+		for range ticker.C {
+			self.update()
+		}
+	}()
+
+	return self
+}
+
+// findDevices maps each host to the tape drives and mcf devices behind it.
+// A multipath device is listed under the host of each of its paths.
+func (self *FC) findDevices() {
+	devices := make(map[string][]string)
+
+	drives, _ := utils.FindDevices()
+	for _, drive := range drives {
+		host := utils.TapeHost(drive)
+		devices[host] = append(devices[host], drive)
+	}
+
+	fses, _, _ := utils.ParseMcf()
+	for _, fs := range fses {
+		for _, d := range fs.Devices() {
+			dev, err := realPath(d.Path)
+			if err != nil {
+				continue
+			}
+			paths := utils.DmSlaves(filepath.Base(dev))
+			if len(paths) == 0 {
+				paths = []string{filepath.Base(dev)}
+			}
+			seen := make(map[string]bool)
+			for _, p := range paths {
+				host := utils.BlockHost(p)
+				if !seen[host] {
+					devices[host] = append(devices[host], filepath.Base(d.Path))
+					seen[host] = true
+				}
+			}
+		}
+	}
+
+	self.devices = devices
+}
+
+func (self *FC) update() {
+	if self.none {
+		self.Rows = make([][]string, 1)
+		self.Rows[0] = make([]string, len(self.Header))
+		self.Rows[0][0] = "None"
+		return
+	}
+
+	if self.watcher.Changed() {
+		self.findDevices()
+	}
+
+	self.countersnew = make(map[string]utils.FcHost, len(self.hosts))
+	for _, host := range self.hosts {
+		h, err := utils.GetFcHost(host)
+		if err != nil && debug {
+			log.Println(err)
+		}
+		self.countersnew[host] = h
+	}
+
+	if self.countersprev == nil {
+		self.countersprev = self.countersnew
+		return
+	}
+
+	self.Rows = make([][]string, len(self.hosts))
+	for i, host := range self.hosts {
+		self.Rows[i] = self.updateHost(host)
+	}
+
+	self.countersprev = self.countersnew
+}
+
+func (self *FC) updateHost(host string) []string {
+	s := make([]string, 13)
+
+	prev := self.countersprev[host].Stats
+	new := self.countersnew[host].Stats
+	// counters the driver doesn't keep are shown as n/a
+	stats := func(stat string) (uint64, uint64, bool) {
+		p, ok := prev[stat]
+		if !ok {
+			return 0, 0, false
+		}
+		n, ok := new[stat]
+		// the statistics were reset or the driver reloaded, so the counter
+		// started again from 0
+		if n < p {
+			p = 0
+		}
+		return p, n, ok
+	}
+	count := func(stat string) string {
+		p, n, ok := stats(stat)
+		if !ok {
+			return "n/a"
+		}
+		return rate(p, n, false)
+	}
+	// fc words are 4 bytes
+	words := func(stat string) string {
+		p, n, ok := stats(stat)
+		if !ok {
+			return "n/a"
+		}
+		return rate(p*4, n*4, true)
+	}
+	errCount := func(stat string) string {
+		p, n, ok := stats(stat)
+		if !ok {
+			return "n/a"
+		}
+		return fmt.Sprintf("%d", n-p)
+	}
+
+	s[0] = host
+	s[1] = self.countersnew[host].PortName
+	s[2] = self.countersnew[host].State
+	s[3] = self.countersnew[host].Speed
+	s[4] = count("tx_frames")
+	s[5] = count("rx_frames")
+	s[6] = words("tx_words")
+	s[7] = words("rx_words")
+	s[8] = errCount("link_failure_count")
+	s[9] = errCount("loss_of_sync_count")
+	s[10] = errCount("invalid_crc_count")
+	s[11] = errCount("error_frames")
+	s[12] = strings.Join(self.devices[host], ",")
+
+	return s
+}
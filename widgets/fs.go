@@ -0,0 +1,185 @@
+package widgets
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	ui "github.com/benmcclelland/termui"
+	"github.com/benmcclelland/vsmtop/utils"
+	"github.com/shirou/gopsutil/disk"
+)
+
+// fsUsage is the capacity of one mcf family set
+type fsUsage struct {
+	name  string
+	mount string
+	usage *disk.UsageStat
+}
+
+// FsUsage shows a fullness gauge for each mcf family set
+type FsUsage struct {
+	*ui.Block
+	interval   time.Duration
+	GaugeColor ui.Color
+
+	infos   []utils.FsInfo
+	watcher *utils.McfWatcher
+	fses    []fsUsage
+	none    bool
+
+	mu sync.Mutex
+}
+
+func NewFsUsage() *FsUsage {
+	var none bool
+	watcher := utils.NewMcfWatcher()
+	f, _, err := utils.ParseMcf()
+	if err != nil || len(f) == 0 {
+		none = true
+	}
+
+	self := &FsUsage{
+		Block:      ui.NewBlock(),
+		interval:   time.Second,
+		GaugeColor: ui.Theme.GaugeColor,
+		infos:      f,
+		watcher:    watcher,
+		none:       none,
+	}
+	self.Label = "Filesystem Usage"
+
+	self.update()
+
+	ticker := time.NewTicker(self.interval)
+	go func() {
+		for range ticker.C {
+			self.update()
+		}
+	}()
+
+	return self
+}
+
+func (self *FsUsage) update() {
+	if self.watcher.Changed() {
+		if f, _, err := utils.ParseMcf(); err == nil {
+			self.mu.Lock()
+			self.infos = f
+			self.none = len(f) == 0
+			self.mu.Unlock()
+		}
+	}
+
+	if self.none {
+		return
+	}
+
+	parts, err := disk.Partitions(true)
+	if err != nil {
+		if debug {
+			log.Println(err)
+		}
+		return
+	}
+	// vsm filesystems are mounted with the family set name as the device
+	mounts := make(map[string]string, len(parts))
+	for _, p := range parts {
+		mounts[p.Device] = p.Mountpoint
+	}
+
+	fses := make([]fsUsage, len(self.infos))
+	for i, fs := range self.infos {
+		fses[i].name = fs.Name
+		mount, ok := mounts[fs.Name]
+		if !ok {
+			continue
+		}
+		fses[i].mount = mount
+		usage, err := disk.Usage(mount)
+		if err != nil {
+			if debug {
+				log.Println(err)
+			}
+			continue
+		}
+		fses[i].usage = usage
+	}
+
+	self.mu.Lock()
+	self.fses = fses
+	self.mu.Unlock()
+}
+
+// Buffer implements the Bufferer interface with two lines per family set,
+// the capacity numbers followed by a gauge of the space used.
+func (self *FsUsage) Buffer() *ui.Buffer {
+	buf := self.Block.Buffer()
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.none {
+		buf.SetString(1, 1, "None", self.Fg, self.Bg)
+		return buf
+	}
+
+	y := 1
+	for _, fs := range self.fses {
+		if y+1 > self.Y {
+			break
+		}
+
+		var line string
+		switch {
+		case fs.mount == "":
+			line = fmt.Sprintf("%s not mounted", fs.name)
+		case fs.usage == nil:
+			line = fmt.Sprintf("%s %s unavailable", fs.name, fs.mount)
+		default:
+			line = fmt.Sprintf("%s %s %s/%s free %s inodes %.0f%%",
+				fs.name, fs.mount, size(fs.usage.Used), size(fs.usage.Total),
+				size(fs.usage.Free), fs.usage.InodesUsedPercent)
+		}
+		buf.SetString(1, y, ui.MaxString(line, self.X), self.Fg, self.Bg)
+
+		if fs.usage != nil {
+			self.drawGauge(buf, y+1, fs.usage.UsedPercent)
+		}
+		y += 2
+	}
+
+	return buf
+}
+
+func (self *FsUsage) drawGauge(buf *ui.Buffer, y int, percent float64) {
+	width := int(percent) * self.X / 100
+	for x := 1; x <= width; x++ {
+		buf.SetCell(x, y, ui.NewCell(' ', self.GaugeColor, self.GaugeColor))
+	}
+
+	s := fmt.Sprintf("%.0f%%", percent)
+	x := (self.X - len(s) + 1) / 2
+	for i, char := range s {
+		fg, bg := self.Fg, self.Bg
+		if x+i < width {
+			fg, bg = self.GaugeColor, ui.AttrReverse
+		}
+		buf.SetCell(1+x+i, y, ui.NewCell(char, fg, bg))
+	}
+}
+
+func size(b uint64) string {
+	switch {
+	case b >= 1e12:
+		return fmt.Sprintf("%.1fTB", utils.BytesToTB(b))
+	case b >= 1e9:
+		return fmt.Sprintf("%.1fGB", utils.BytesToGB(b))
+	case b >= 1e6:
+		return fmt.Sprintf("%.1fMB", utils.BytesToMB(b))
+	case b >= 1e3:
+		return fmt.Sprintf("%.1fkB", utils.BytesToKB(b))
+	}
+	return fmt.Sprintf("%dB", b)
+}
@@ -9,7 +9,7 @@ import (
 const KEYBINDS = `
 Quit: q or <C-c>
 
-<tab>: cycle process/disk/tape focus
+<tab>: cycle process/disk/tape/event focus
 
 Table Navigation
   - <up>/<down> and j/k: up and down
@@ -21,11 +21,28 @@ Process Sorting
   - c: CPU
   - m: Mem
   - p: PID
+  - s: Command
+  - S: State
+  - t and r: Tx and Rx
+  - W and R: disk write and read
+  - i: IOWAIT%
+  - I: reverse the order
+  - click a header to sort, also disk and tape
+  - NI, IOPRIO and x columns: header click only
 
 n: cycle selected interface stats
-dd: kill the selected process
+dd: signal the selected process or group
+N: nice and I/O priority of the process or group
+g: group processes by command
+/: filter processes, e.g. cpu>5 && cmd~arfind
 h and l: zoom in and out of CPU and Mem graphs
-a: display all processes
+a: display all processes or disks
+f: cycle process filter presets
+<enter>/<space>: expand disk/tape details
+<enter> on a process: details (esc closes)
+w: wait channel and kernel stack of a process
+x: toggle disk latency, process syscall columns
+<enter> on an event: jump to its device
 
 Disk and Net perf stats only aviable as root
 
@@ -39,7 +56,7 @@ type HelpMenu struct {
 func NewHelpMenu() *HelpMenu {
 	block := ui.NewBlock()
 	block.X = 48 // width - 1
-	block.Y = 24 // height - 1
+	block.Y = 40 // height - 1
 	return &HelpMenu{block}
 }
 
@@ -0,0 +1,193 @@
+package widgets
+
+import (
+	"fmt"
+	"strings"
+
+	ui "github.com/benmcclelland/termui"
+	"github.com/benmcclelland/vsmtop/utils"
+)
+
+// rows of the priority menu
+const (
+	prioNice = iota
+	prioClass
+	prioLevel
+)
+
+// PrioMenu is a dialog for changing the nice value and I/O scheduling of a
+// process or a group of processes. The nice value and the I/O scheduling are
+// only set if they are changed, so that an unknown class or the different
+// priorities of a group are left alone.
+type PrioMenu struct {
+	*ui.Block
+	procs     []utils.ProcHandle
+	target    string
+	nice      int
+	class     int // -1 if unknown
+	level     int
+	openNice  int
+	openClass int
+	openLevel int
+	selected  int
+	Cursor    ui.Color
+}
+
+func NewPrioMenu() *PrioMenu {
+	block := ui.NewBlock()
+	block.Label = "Priority"
+	block.X = 48 // width - 1
+	block.Y = 8  // height - 1
+	return &PrioMenu{
+		Block:  block,
+		Cursor: ui.Theme.TableCursor,
+	}
+}
+
+// Open sets the processes to change, with target describing them, starting
+// from the priorities they have now.
+func (self *PrioMenu) Open(procs []utils.ProcHandle, target string, nice, class, level int) {
+	self.procs = procs
+	self.target = target
+	self.nice, self.openNice = nice, nice
+	self.class, self.openClass = class, class
+	self.level, self.openLevel = level, level
+	self.selected = prioNice
+}
+
+func (self *PrioMenu) Up() {
+	if self.selected > prioNice {
+		self.selected--
+	}
+}
+
+func (self *PrioMenu) Down() {
+	if self.selected < prioLevel {
+		self.selected++
+	}
+}
+
+// Change moves the selected value by delta, keeping it in range.
+func (self *PrioMenu) Change(delta int) {
+	switch self.selected {
+	case prioNice:
+		self.nice = clamp(self.nice+delta, -20, 19)
+	case prioClass:
+		self.class = clamp(self.class+delta, 0, len(utils.IOPrioClasses)-1)
+	case prioLevel:
+		self.level = clamp(self.level+delta, 0, utils.IOPrioLevels-1)
+	}
+}
+
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// Apply sets the priorities of each process and returns a status line with
+// the result. Processes whose PID has been reused since they were scanned
+// are skipped.
+func (self *PrioMenu) Apply() string {
+	var changed []string
+	nice := utils.NiceUnchanged
+	if self.nice != self.openNice {
+		nice = self.nice
+		changed = append(changed, fmt.Sprintf("nice %d", self.nice))
+	}
+	class := -1
+	if self.class >= 0 && (self.class != self.openClass || self.level != self.openLevel) {
+		class = self.class
+		changed = append(changed, "io "+utils.FormatIOPrio(self.class, self.level))
+	}
+	if len(changed) == 0 {
+		return fmt.Sprintf("priority of %s unchanged", self.target)
+	}
+	prio := strings.Join(changed, " ")
+
+	var set, skipped int
+	var niceErr, ioErr error
+	for _, p := range self.procs {
+		nerr, ierr := p.SetPriority(nice, class, self.level)
+		if nerr == utils.ErrPidReused {
+			skipped++
+			continue
+		}
+		if nerr != nil && niceErr == nil {
+			niceErr = fmt.Errorf("nice of %d: %v", p.Pid, nerr)
+		}
+		if ierr != nil && ioErr == nil {
+			ioErr = fmt.Errorf("I/O priority of %d: %v", p.Pid, ierr)
+		}
+		if nerr == nil && ierr == nil {
+			set++
+		}
+	}
+	var errs []string
+	for _, err := range []error{niceErr, ioErr} {
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(self.procs) == 1 {
+		switch {
+		case skipped > 0:
+			return fmt.Sprintf("%s for %s not set: %v", prio, self.target, utils.ErrPidReused)
+		case len(errs) > 0:
+			return fmt.Sprintf("%s for %s failed: %s", prio, self.target, strings.Join(errs, ", "))
+		}
+	}
+	if set == len(self.procs) {
+		return fmt.Sprintf("set %s for %s", prio, self.target)
+	}
+	status := fmt.Sprintf("set %s for %d/%d of %s", prio, set, len(self.procs), self.target)
+	if skipped > 0 {
+		status += fmt.Sprintf(", %d skipped as reused PIDs", skipped)
+	}
+	if len(errs) > 0 {
+		status += ", " + strings.Join(errs, ", ")
+	}
+	return status
+}
+
+func (self *PrioMenu) Buffer() *ui.Buffer {
+	buf := self.Block.Buffer()
+
+	self.Block.XOffset = (ui.Body.Width - self.Block.X) / 2  // X coordinate
+	self.Block.YOffset = (ui.Body.Height - self.Block.Y) / 2 // Y coordinate
+
+	target := self.target
+	if len(target) > self.X-2 {
+		target = target[:self.X-2]
+	}
+	buf.SetString(2, 1, target, self.Fg, self.Bg)
+
+	class := "?"
+	if self.class >= 0 && self.class < len(utils.IOPrioClasses) {
+		class = utils.IOPrioClasses[self.class]
+	}
+	level := "-"
+	if self.class == utils.IOPrioClassRT || self.class == utils.IOPrioClassBE {
+		level = fmt.Sprint(self.level)
+	}
+	lines := []string{
+		fmt.Sprintf("%-12s < %3d >", "nice", self.nice),
+		fmt.Sprintf("%-12s < %4s >", "I/O class", class),
+		fmt.Sprintf("%-12s < %3s >", "I/O priority", level),
+	}
+	for i, line := range lines {
+		fg, bg := self.Fg, self.Bg
+		if i == self.selected {
+			bg = self.Cursor
+		}
+		buf.SetString(4, i+3, line, fg, bg)
+	}
+	buf.SetString(2, self.Y-1, "<left>/<right> change, <enter> set", self.Fg, self.Bg)
+
+	return buf
+}
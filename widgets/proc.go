@@ -4,60 +4,151 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os/exec"
 	"sort"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	ui "github.com/benmcclelland/termui"
 	"github.com/benmcclelland/vsmtop/utils"
 	psCPU "github.com/shirou/gopsutil/cpu"
-	psProc "github.com/shirou/gopsutil/process"
 )
 
 const (
-	UP       = "▲"
-	DOWN     = "▼"
-	psprefix = "sam-"
+	UP   = "▲"
+	DOWN = "▼"
+
+	procLabel = "VSM Process List"
+
+	// how long a second g has to be pressed after the first to jump to the top
+	// instead of toggling grouping
+	ggWait = 300 * time.Millisecond
+	// how long the result of a signal is shown
+	statusTime = 10 * time.Second
+	// how long a process has to be in uninterruptible sleep to be highlighted
+	stuckTime = 10 * time.Second
+	// how long a process is highlighted after it started
+	newTime = 30 * time.Second
+	// a daemon that starts this soon after one with the same command and
+	// parent exited is reported as restarted
+	restartTime = time.Minute
+	// a process that isn't a daemon is only reported when it exits after
+	// running this long
+	longLivedTime = time.Hour
+)
+
+// keys that sort the process list by each column, in column order. The
+// columns after IOWAIT% are sorted by clicking their header.
+var procSortKeys = []string{"p", "s", "S", "c", "m", "t", "r", "W", "R", "i"}
+
+var (
+	procHeader = []string{"PID", "Command", "S", "CPU%", "Mem%", "Tx-MBpS", "Rx-MBpS", "WMBps", "RMBps", "IOWAIT%", "NI", "IOPRIO"}
+	// syscall rates and writes cancelled by truncation, toggled with x
+	procExtHeader = []string{"RSysc/s", "WSysc/s", "Cancel-MBps"}
 )
 
 // Process represents each process.
 type Process struct {
 	PID     int32
 	Command string
+	Cmdline string // only read while a search needs it
+	State   string // R, S, D, Z, T...
+	Started time.Time
 	CPU     float64
 	Mem     float32
 	InMBpS  float64
 	OutMBps float64
 	WMBps   float64
 	RMBps   float64
+	IOWait  float64 // % of the time waiting for block I/O
+	RSysc   float64 // read syscalls per second
+	WSysc   float64 // write syscalls per second
+	CMBps   float64 // cancelled writes
+	Nice    int
+	IOClass int // -1 if unknown
+	IOLevel int
+	// prioMixed is set on a group whose processes have different priorities
+	prioMixed bool
 }
 
 type dPerf struct {
-	wBytes uint64
-	rBytes uint64
+	started time.Time
+	ioOk    bool // the io file was read, not just stat
+	wBytes  uint64
+	rBytes  uint64
+	cBytes  uint64
+	syscr   uint64
+	syscw   uint64
+	blkio   time.Duration
+	at      time.Time
 }
 
 type Proc struct {
 	*ui.Table
 	cpuCount         int
 	interval         time.Duration
-	sortMethod       string
+	sort             tableSort
 	procs            []Process
 	KeyPressed       chan bool
 	DefaultColWidths []int
 	dperf            map[int32]dPerf
+	handles          map[int32]utils.ProcHandle // the shown processes as scanned
+	scanner          *utils.ProcScanner
 	cancel           context.CancelFunc
 	netperf          *utils.NetPerf
 	allprocs         bool
+	extended         bool
+	filters          []utils.ProcFilter
+	filter           int
+	group            bool
+	groupedProcs     []Process
+	groupPids        map[string][]int32
+	gTimer           *time.Timer
+	status           string
+	statusUntil      time.Time
+	dSince           map[int32]time.Time // when each process went into D state
+	stuck            map[int32]bool
+	rowColors        map[int]ui.Color
+	rowProcs         []Process // the process or group of each row
+	AlertColor       ui.Color
+	NewColor         ui.Color
+	known            map[int32]procLife    // processes at the last update, for lifecycle events
+	exited           map[procKey]time.Time // when a daemon of each command and parent last exited
+	search           string
+	searchExpr       procExpr
+	searchErr        error
+	searching        bool
+	// Detail is called with the PID of the selected process when enter is
+	// pressed
+	Detail func(pid int32)
+	// Stacks is called with the PID of the selected process when w is
+	// pressed
+	Stacks func(pid int32)
+	// StartSearch is called when / is pressed to send the typed keys to
+	// SearchKey until EndSearch
+	StartSearch func()
+	// Scanned is called with every process after each update, for widgets
+	// that watch processes without a scan of their own
+	Scanned func(procs []*utils.ProcStat)
+	// Lifecycle is called when a process of the filter starts, exits or
+	// restarts
+	Lifecycle func(t time.Time, msg string)
+	// Signal is called with the processes of the selected row to choose a
+	// signal to send to them
+	Signal func(procs []utils.ProcHandle, target string)
+	// Priority is called with the processes of the selected row and their
+	// current priorities to choose new ones
+	Priority func(procs []utils.ProcHandle, target string, nice, ioClass, ioLevel int)
+	ReadOnly bool
 
 	// synchronize simultaneous updates due to user keypressed
 	mu sync.Mutex
 }
 
-func NewProc(keyPressed chan bool) *Proc {
+// NewProc creates the process list, showing the processes matched by the
+// first of filters and cycling through the rest with 'f'. It isn't updated
+// until Start is called.
+func NewProc(keyPressed chan bool, filters []utils.ProcFilter) *Proc {
 	cpuCount, err := psCPU.Counts(false)
 	if err != nil {
 		panic(err)
@@ -65,12 +156,20 @@ func NewProc(keyPressed chan bool) *Proc {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
+	if len(filters) == 0 {
+		filters = utils.DefaultProcFilters
+	}
+
+	scanner := utils.NewProcScanner(utils.PROCROOT)
 	var pids []int32
-	psProcesses, _ := psProc.Processes()
-	for _, psProcess := range psProcesses {
-		command, _ := psProcess.Name()
-		if strings.HasPrefix(command, psprefix) {
-			pids = append(pids, psProcess.Pid)
+	procs, _ := scanner.Scan()
+	var tree *utils.ProcTree
+	if filters[0].NeedsTree() {
+		tree = utils.NewProcTree(procs)
+	}
+	for _, p := range procs {
+		if filters[0].Match(p, tree) {
+			pids = append(pids, p.Pid)
 		}
 	}
 
@@ -83,20 +182,31 @@ func NewProc(keyPressed chan bool) *Proc {
 		Table:      ui.NewTable(),
 		interval:   time.Second,
 		cpuCount:   cpuCount,
-		sortMethod: "c",
+		sort:       tableSort{col: 3},
 		KeyPressed: keyPressed,
 		dperf:      make(map[int32]dPerf),
+		scanner:    scanner,
 		cancel:     cancel,
 		netperf:    n,
+		filters:    filters,
+		dSince:     make(map[int32]time.Time),
+		AlertColor: ui.Theme.Fg,
+		NewColor:   ui.Theme.Fg,
+		exited:     make(map[procKey]time.Time),
 	}
-	self.Label = "VSM Process List"
+	self.setLabel()
 	self.ColResizer = self.ColResize
-	self.DefaultColWidths = []int{5, 10, 4, 4, 6, 6, 6, 6}
-	self.ColWidths = make([]int, 8)
+	self.DefaultColWidths = []int{5, 10, 1, 4, 4, 6, 6, 6, 6, 7, 3, 6, 7, 7, 11}
 	self.UniqueCol = 0
 
 	self.ForeGround()
 
+	return self
+}
+
+// Start updates the process list and keeps updating it every interval. The
+// callbacks that updates make, Scanned and Lifecycle, have to be set before.
+func (self *Proc) Start() {
 	self.update()
 
 	ticker := time.NewTicker(self.interval)
@@ -105,8 +215,6 @@ func NewProc(keyPressed chan bool) *Proc {
 			self.update()
 		}
 	}()
-
-	return self
 }
 
 func (self *Proc) Cleanup() {
@@ -119,7 +227,7 @@ func (self *Proc) update() {
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
-	psProcesses, err := psProc.Processes()
+	procs, err := self.scanner.Scan()
 	if err != nil {
 		if debug {
 			log.Println(err)
@@ -127,120 +235,386 @@ func (self *Proc) update() {
 		return
 	}
 
+	filter := self.filters[self.filter]
+	var tree *utils.ProcTree
+	if !self.allprocs && filter.NeedsTree() {
+		tree = utils.NewProcTree(procs)
+	}
+
 	var pids []int32
-	for _, psProcess := range psProcesses {
-		command, err := psProcess.Name()
-		if err != nil {
-			if debug {
-				log.Println(err)
-			}
-			continue
-		}
-		if self.allprocs || strings.HasPrefix(command, psprefix) {
-			pids = append(pids, psProcess.Pid)
+	var shown []*utils.ProcStat
+	for _, p := range procs {
+		if self.allprocs || filter.Match(p, tree) {
+			pids = append(pids, p.Pid)
+			shown = append(shown, p)
 		}
 	}
 	self.netperf.Update(pids)
+	self.trackLifecycle(procs, shown)
+	if self.Scanned != nil {
+		self.Scanned(procs)
+	}
 
 	self.procs = []Process{}
-	for _, psProcess := range psProcesses {
-		command, err := psProcess.Name()
-		if err != nil {
+	self.handles = make(map[int32]utils.ProcHandle, len(shown))
+	for _, p := range shown {
+		pid := p.Pid
+		if err := self.scanner.ReadUsage(p); err != nil {
 			if debug {
 				log.Println(err)
 			}
 			continue
 		}
-		if self.allprocs || strings.HasPrefix(command, psprefix) {
-			pid := psProcess.Pid
-			cpu, err := psProcess.CPUPercent()
-			if err != nil {
-				if debug {
-					log.Println(err)
-				}
-				continue
+
+		var wmbps, rmbps, iowait, rsysc, wsysc, cmbps float64
+		pio := p.IO
+		now := time.Now()
+		ioOk := p.IOErr == nil
+		if !ioOk {
+			wmbps, rmbps, rsysc, wsysc, cmbps = -1.0, -1.0, -1.0, -1.0, -1.0
+		}
+		// a PID can be reused by a new process between updates
+		if perf, ok := self.dperf[pid]; ok && perf.started.Equal(p.Started) {
+			// the accounting stats are over the actual time since the last
+			// update, which is shorter when it was triggered by a key
+			elapsed := now.Sub(perf.at)
+			secs := elapsed.Seconds()
+			// the block I/O delay is in stat, which can be read when io can't
+			if elapsed > 0 {
+				iowait = float64(pio.BlkioDelay-perf.blkio) / float64(elapsed) * 100
 			}
-			mem, err := psProcess.MemoryPercent()
-			if err != nil {
-				if debug {
-					log.Println(err)
+			if ioOk && perf.ioOk {
+				wmbps = utils.BytesToMB(pio.WriteBytes - perf.wBytes)
+				rmbps = utils.BytesToMB(pio.ReadBytes - perf.rBytes)
+				if elapsed > 0 {
+					rsysc = float64(pio.Syscr-perf.syscr) / secs
+					wsysc = float64(pio.Syscw-perf.syscw) / secs
+					cmbps = utils.BytesToMB(pio.CancelledWriteBytes-perf.cBytes) / secs
 				}
-				continue
 			}
+		}
+		self.dperf[pid] = dPerf{
+			started: p.Started,
+			ioOk:    ioOk,
+			wBytes:  pio.WriteBytes,
+			rBytes:  pio.ReadBytes,
+			cBytes:  pio.CancelledWriteBytes,
+			syscr:   pio.Syscr,
+			syscw:   pio.Syscw,
+			blkio:   pio.BlkioDelay,
+			at:      now,
+		}
 
-			var wmbps, rmbps float64
-			dstats, err := psProcess.IOCounters()
-			if err != nil {
-				wmbps = -1.0
-				rmbps = -1.0
-			} else {
-				if perf, ok := self.dperf[pid]; ok {
-					wmbps = utils.BytesToMB(dstats.WriteBytes - perf.wBytes)
-					perf.wBytes = dstats.WriteBytes
-					rmbps = utils.BytesToMB(dstats.ReadBytes - perf.rBytes)
-					perf.rBytes = dstats.ReadBytes
-					self.dperf[pid] = perf
-				} else {
-					wmbps = 0.0
-					perf.wBytes = dstats.WriteBytes
-					rmbps = 0.0
-					perf.rBytes = dstats.ReadBytes
-					self.dperf[pid] = perf
-				}
-			}
+		self.handles[pid] = p.Handle()
+
+		ioClass, ioLevel, err := p.IOPrio()
+		if err != nil {
+			ioClass = -1
+		}
+
+		var tx, rx int
+		if pstat, ok := self.netperf.Pstats[pid]; ok {
+			tx, rx = pstat.Get()
+		} else {
+			tx, rx = 0, 0
+		}
 
-			var tx, rx int
-			if pstat, ok := self.netperf.Pstats[pid]; ok {
-				tx, rx = pstat.Get()
-			} else {
-				tx, rx = 0, 0
+		var cmdline string
+		if self.searchExpr != nil && self.searchExpr.cmdline() {
+			cmdline, _ = p.Cmdline()
+		}
+
+		if p.State == "D" {
+			if _, ok := self.dSince[pid]; !ok {
+				self.dSince[pid] = time.Now()
 			}
+		} else {
+			delete(self.dSince, pid)
+		}
 
-			self.procs = append(self.procs, Process{
-				PID:     pid,
-				Command: command,
-				CPU:     cpu / float64(self.cpuCount),
-				Mem:     mem,
-				InMBpS:  utils.BytesToMB(uint64(rx)),
-				OutMBps: utils.BytesToMB(uint64(tx)),
-				WMBps:   wmbps,
-				RMBps:   rmbps,
-			})
+		self.procs = append(self.procs, Process{
+			PID:     pid,
+			Command: p.Name,
+			Cmdline: cmdline,
+			State:   p.State,
+			Started: p.Started,
+			CPU:     p.CPU / float64(self.cpuCount),
+			Mem:     p.Mem,
+			InMBpS:  utils.BytesToMB(uint64(rx)),
+			OutMBps: utils.BytesToMB(uint64(tx)),
+			WMBps:   wmbps,
+			RMBps:   rmbps,
+			IOWait:  iowait,
+			RSysc:   rsysc,
+			WSysc:   wsysc,
+			CMBps:   cmbps,
+			Nice:    p.Nice,
+			IOClass: ioClass,
+			IOLevel: ioLevel,
+		})
+	}
+
+	self.stuck = make(map[int32]bool)
+	seen := make(map[int32]bool, len(self.procs))
+	for _, p := range self.procs {
+		seen[p.PID] = true
+	}
+	for pid, since := range self.dSince {
+		if !seen[pid] {
+			delete(self.dSince, pid)
+		} else if time.Since(since) > stuckTime {
+			self.stuck[pid] = true
 		}
 	}
+	for pid := range self.dperf {
+		if !seen[pid] {
+			delete(self.dperf, pid)
+		}
+	}
+
+	if self.status != "" && time.Now().After(self.statusUntil) {
+		self.status = ""
+		self.setLabel()
+	}
 
 	self.Sort()
 }
 
-// Sort sorts either the grouped or ungrouped []Process based on the sortMethod.
+// procKey is a command started by a parent process
+type procKey struct {
+	ppid    int32
+	command string
+}
+
+type procLife struct {
+	procKey
+	started time.Time
+	daemon  bool // started by init or sam-fsd
+}
+
+// trackLifecycle reports the daemons in shown that started, exited or
+// restarted since the last update, and the other processes that exited after
+// running for longer than longLivedTime, so that movers and other short-lived
+// children don't flood the events. scanned, every process of the scan, is
+// used to find the parent of each process. Nothing is reported in the all
+// processes view, or for processes that only came into view because the
+// filter changed.
+func (self *Proc) trackLifecycle(scanned, shown []*utils.ProcStat) {
+	now := time.Now()
+	names := make(map[int32]string, len(scanned))
+	for _, p := range scanned {
+		names[p.Pid] = p.Name
+	}
+	current := make(map[int32]procLife, len(shown))
+	for _, p := range shown {
+		current[p.Pid] = procLife{
+			procKey: procKey{ppid: p.Ppid, command: p.Name},
+			started: p.Started,
+			daemon:  p.Ppid == 1 || names[p.Ppid] == "sam-fsd",
+		}
+	}
+	known := self.known
+	self.known = current
+	for key, t := range self.exited {
+		if now.Sub(t) > restartTime {
+			delete(self.exited, key)
+		}
+	}
+	if known == nil || self.allprocs || self.Lifecycle == nil {
+		return
+	}
+
+	var gone []int32
+	for pid, l := range known {
+		if c, ok := current[pid]; !ok || !c.started.Equal(l.started) {
+			gone = append(gone, pid)
+		}
+	}
+	sort.Slice(gone, func(i, j int) bool { return gone[i] < gone[j] })
+	for _, pid := range gone {
+		l := known[pid]
+		ran := now.Sub(l.started)
+		if !l.daemon && ran < longLivedTime {
+			continue
+		}
+		if l.daemon {
+			self.exited[l.procKey] = now
+		}
+		self.Lifecycle(now, fmt.Sprintf("%s exited (pid %d, ran %s)", l.command, pid, shortDuration(ran)))
+	}
+
+	for _, p := range shown {
+		if l, ok := known[p.Pid]; ok && l.started.Equal(p.Started) {
+			continue
+		}
+		c := current[p.Pid]
+		if !c.daemon {
+			continue
+		}
+		if _, ok := self.exited[c.procKey]; ok {
+			self.Lifecycle(now, fmt.Sprintf("%s restarted (pid %d)", p.Name, p.Pid))
+		} else {
+			self.Lifecycle(now, fmt.Sprintf("%s started (pid %d)", p.Name, p.Pid))
+		}
+	}
+}
+
+func (self *Proc) isStuck(p Process) bool {
+	if !self.group {
+		return self.stuck[p.PID]
+	}
+	for _, pid := range self.groupPids[p.Command] {
+		if self.stuck[pid] {
+			return true
+		}
+	}
+	return false
+}
+
+// Group merges processes with the same command into a single row, with the
+// number of processes in the PID column and the sum of their stats, except
+// IOWAIT%, which is that of the process waiting the most. The I/O stats of
+// processes whose io file can't be read are left out, and are only shown as
+// unavailable if that is so for every process in the group.
+func (self *Proc) Group(procs []Process) {
+	groups := make(map[string]Process)
+	self.groupPids = make(map[string][]int32)
+	for _, p := range procs {
+		g := groups[p.Command]
+		g.Command = p.Command
+		// a group is in D state if any of its processes are
+		if g.State == "" || p.State == "D" {
+			g.State = p.State
+		}
+		if g.PID == 0 {
+			g.Nice, g.IOClass, g.IOLevel = p.Nice, p.IOClass, p.IOLevel
+			g.WMBps, g.RMBps, g.IOWait, g.RSysc, g.WSysc, g.CMBps = -1, -1, -1, -1, -1, -1
+		} else if g.Nice != p.Nice || g.IOClass != p.IOClass || g.IOLevel != p.IOLevel {
+			g.prioMixed = true
+		}
+		g.PID++
+		// a group is new if any of its processes are
+		if p.Started.After(g.Started) {
+			g.Started = p.Started
+		}
+		g.CPU += p.CPU
+		g.Mem += p.Mem
+		g.InMBpS += p.InMBpS
+		g.OutMBps += p.OutMBps
+		addStat(&g.WMBps, p.WMBps)
+		addStat(&g.RMBps, p.RMBps)
+		// IOWAIT% is of the time, so adding it up could go over 100
+		if p.IOWait > g.IOWait {
+			g.IOWait = p.IOWait
+		}
+		addStat(&g.RSysc, p.RSysc)
+		addStat(&g.WSysc, p.WSysc)
+		addStat(&g.CMBps, p.CMBps)
+		groups[p.Command] = g
+		self.groupPids[p.Command] = append(self.groupPids[p.Command], p.PID)
+	}
+
+	self.groupedProcs = make([]Process, 0, len(groups))
+	for _, g := range groups {
+		self.groupedProcs = append(self.groupedProcs, g)
+	}
+}
+
+// addStat adds a process stat to the sum for its group, leaving out the -1
+// of an unavailable stat. The sum stays -1 until a stat is added.
+func addStat(sum *float64, stat float64) {
+	if stat < 0 {
+		return
+	}
+	if *sum < 0 {
+		*sum = 0
+	}
+	*sum += stat
+}
+
+// Sort sorts either the grouped or ungrouped []Process by the sort column.
 // Called with every update, when the sort method is changed, and when processes are grouped and ungrouped.
 func (self *Proc) Sort() {
-	self.Header = []string{"PID", "Command", "CPU%", "Mem%", "Tx-MBpS", "Rx-MBpS", "WMBps", "RMBps"}
+	self.Header = append([]string{}, procHeader...)
+	if self.extended {
+		self.Header = append(self.Header, procExtHeader...)
+	} else if self.sort.col >= len(self.Header) {
+		self.sort = tableSort{col: 3}
+	}
 
 	processes := &self.procs
+	if self.searchExpr != nil {
+		var matched []Process
+		for i := range self.procs {
+			if self.searchExpr.match(&self.procs[i]) {
+				matched = append(matched, self.procs[i])
+			}
+		}
+		processes = &matched
+	}
+	if self.group {
+		self.Header[0] = "Count"
+		self.Group(*processes)
+		processes = &self.groupedProcs
+	}
 
-	switch self.sortMethod {
-	case "c":
-		sort.Sort(sort.Reverse(ProcessByCPU(*processes)))
-		self.Header[2] += DOWN
-	case "p":
-		sort.Sort(ProcessByPID(*processes))
-		self.Header[0] += DOWN
-	case "m":
-		sort.Sort(sort.Reverse(ProcessByMem(*processes)))
-		self.Header[3] += DOWN
+	// names and states sort alphabetically and PIDs in order, everything else starts
+	// with the busiest process
+	desc := self.sort.descending(self.sort.col > 2 || (self.sort.col == 0 && self.group))
+	less := procLess(self.sort.col)
+	sort.SliceStable(*processes, func(i, j int) bool {
+		a, b := (*processes)[i], (*processes)[j]
+		if desc {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		// keep rows in place when the sort values are equal
+		if a.Command != b.Command {
+			return (*processes)[i].Command < (*processes)[j].Command
+		}
+		return (*processes)[i].PID < (*processes)[j].PID
+	})
+	self.sort.marker(self.Header, desc)
+
+	self.Rows = FieldsToStrings(*processes, self.extended)
+	self.rowProcs = *processes
+
+	// highlight processes stuck in uninterruptible sleep and ones that just
+	// started, or groups with one
+	self.rowColors = make(map[int]ui.Color)
+	for i, p := range *processes {
+		if self.isStuck(p) {
+			self.rowColors[i] = self.AlertColor
+		} else if time.Since(p.Started) < newTime {
+			self.rowColors[i] = self.NewColor
+		}
 	}
+}
+
+// Buffer implements the Bufferer interface and highlights processes stuck in
+// D state and new processes.
+func (self *Proc) Buffer() *ui.Buffer {
+	self.mu.Lock()
+	defer self.mu.Unlock()
 
-	self.Rows = FieldsToStrings(*processes)
+	buf := self.Table.Buffer()
+	colorRows(self.Table, buf, self.rowColors)
+	return buf
 }
 
 // ColResize overrides the default ColResize in the termui table.
 func (self *Proc) ColResize() {
-	copy(self.ColWidths, self.DefaultColWidths)
+	self.ColWidths = append([]int{}, self.DefaultColWidths[:len(self.Header)]...)
 
 	self.Gap = 3
 
-	self.CellXPos = []int{self.Gap, 0, 0, 0, 0, 0, 0, 0}
+	self.CellXPos = make([]int, len(self.ColWidths))
+	self.CellXPos[0] = self.Gap
 
 	total := self.Gap
 
@@ -255,22 +629,30 @@ func (self *Proc) ColResize() {
 	}
 
 	// only renders a column if it fits
-	if self.X < (rowWidth - self.Gap - self.ColWidths[3]) {
-		self.ColWidths[2] = 0
+	if self.X < (rowWidth - self.Gap - self.ColWidths[4]) {
 		self.ColWidths[3] = 0
 		self.ColWidths[4] = 0
 		self.ColWidths[5] = 0
+		self.ColWidths[6] = 0
 	} else if self.X < rowWidth {
-		self.CellXPos[2] = self.CellXPos[3]
-		self.ColWidths[3] = 0
+		self.CellXPos[3] = self.CellXPos[4]
 		self.ColWidths[4] = 0
 		self.ColWidths[5] = 0
+		self.ColWidths[6] = 0
 	}
 }
 
 func (self *Proc) ForeGround() {
 	ui.On("<MouseLeft>", func(e ui.Event) {
-		self.Click(e.MouseX, e.MouseY)
+		if col := headerColumn(self.Table, e.MouseX, e.MouseY); col >= 0 {
+			self.mu.Lock()
+			self.sort.click(col)
+			self.Top()
+			self.Sort()
+			self.mu.Unlock()
+		} else {
+			self.Click(e.MouseX, e.MouseY)
+		}
 		self.KeyPressed <- true
 	})
 
@@ -319,120 +701,395 @@ func (self *Proc) ForeGround() {
 
 	ui.On("dd", func(e ui.Event) {
 		self.Kill()
+		self.KeyPressed <- true
+	})
+
+	ui.On("N", func(e ui.Event) {
+		self.Renice()
+		self.KeyPressed <- true
+	})
+
+	ui.On("<enter>", func(e ui.Event) {
+		if pid, ok := self.selectedPid(); ok && self.Detail != nil {
+			self.Detail(pid)
+		}
+	})
+
+	ui.On("w", func(e ui.Event) {
+		if pid, ok := self.selectedPid(); ok && self.Stacks != nil {
+			self.Stacks(pid)
+		}
+	})
+
+	ui.On("/", func(e ui.Event) {
+		if self.StartSearch != nil {
+			self.BeginSearch()
+			self.StartSearch()
+			self.KeyPressed <- true
+		}
 	})
 
-	ui.On("m", "c", "p", func(e ui.Event) {
-		if self.sortMethod != e.Key {
-			self.sortMethod = e.Key
+	// g is bound on its own so gg has to be caught here
+	ui.On("g", func(e ui.Event) {
+		self.mu.Lock()
+		if self.gTimer != nil && self.gTimer.Stop() {
+			self.gTimer = nil
 			self.Top()
-			self.Sort()
+			self.mu.Unlock()
+			self.KeyPressed <- true
+			return
+		}
+		self.gTimer = time.AfterFunc(ggWait, func() {
+			self.ToggleGroup()
+			self.KeyPressed <- true
+		})
+		self.mu.Unlock()
+	})
+
+	ui.On(procSortKeys, func(e ui.Event) {
+		self.mu.Lock()
+		sorted := false
+		for col, key := range procSortKeys {
+			if key == e.Key && col != self.sort.col {
+				self.sort = tableSort{col: col}
+				self.Top()
+				self.Sort()
+				sorted = true
+			}
+		}
+		self.mu.Unlock()
+		if sorted {
 			self.KeyPressed <- true
 		}
 	})
 
+	ui.On("I", func(e ui.Event) {
+		self.mu.Lock()
+		self.sort.reverse = !self.sort.reverse
+		self.Top()
+		self.Sort()
+		self.mu.Unlock()
+		self.KeyPressed <- true
+	})
+
+	ui.On("x", func(e ui.Event) {
+		self.ToggleExtended()
+		self.KeyPressed <- true
+	})
+
 	ui.On("a", func(e ui.Event) {
 		self.ToggleProcs()
 		self.update()
 		self.KeyPressed <- true
 	})
+
+	ui.On("f", func(e ui.Event) {
+		self.NextFilter()
+		self.update()
+		self.KeyPressed <- true
+	})
+}
+
+// ToggleExtended shows or hides the syscall and cancelled write columns.
+func (self *Proc) ToggleExtended() {
+	self.mu.Lock()
+	self.extended = !self.extended
+	self.Sort()
+	self.mu.Unlock()
 }
 
 func (self *Proc) ToggleProcs() {
+	self.mu.Lock()
+	self.allprocs = !self.allprocs
+	self.known = nil
+	self.setLabel()
+	self.mu.Unlock()
+}
+
+// NextFilter switches to the next filter preset, leaving the all processes
+// view if it was on.
+func (self *Proc) NextFilter() {
+	self.mu.Lock()
 	if self.allprocs {
 		self.allprocs = false
-		return
+	} else {
+		self.filter = (self.filter + 1) % len(self.filters)
+	}
+	self.known = nil
+	self.setLabel()
+	self.mu.Unlock()
+}
+
+func (self *Proc) setLabel() {
+	name := self.filters[self.filter].Name
+	if self.allprocs {
+		name = "all"
+	}
+	self.Label = fmt.Sprintf("%s [%s]", procLabel, name)
+	if self.group {
+		self.Label += " grouped"
+	}
+	if self.searching || self.search != "" {
+		self.Label += " /" + self.search
+	}
+	if self.searching {
+		self.Label += "_"
+	}
+	if self.searchErr != nil {
+		self.Label += " (" + self.searchErr.Error() + ")"
+	}
+	if self.status != "" {
+		self.Label += " - " + self.status
+	}
+}
+
+// BeginSearch starts editing the filter expression shown after / in the label.
+func (self *Proc) BeginSearch() {
+	self.mu.Lock()
+	self.searching = true
+	self.setLabel()
+	self.mu.Unlock()
+}
+
+// SearchKey adds a typed key to the filter expression, narrowing the rows
+// as it is typed. While the expression doesn't parse the last one that did
+// stays in use.
+func (self *Proc) SearchKey(key string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	switch key {
+	case "<backspace>", "<C-8>":
+		if r := []rune(self.search); len(r) > 0 {
+			self.search = string(r[:len(r)-1])
+		}
+	case "<space>":
+		self.search += " "
+	default:
+		self.search += key
+	}
+	self.setSearch()
+}
+
+// EndSearch stops editing the filter expression, keeping it or clearing it.
+func (self *Proc) EndSearch(keep bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.searching = false
+	if !keep {
+		self.search = ""
+	}
+	self.setSearch()
+}
+
+func (self *Proc) setSearch() {
+	e, err := parseProcExpr(self.search)
+	self.searchErr = err
+	// the command lines are only read from the next update on
+	if err == nil {
+		self.searchExpr = e
 	}
-	self.allprocs = true
+	self.setLabel()
+	self.Top()
+	self.Sort()
 }
 
 func (self *Proc) BackGround() {
 	events := []string{
 		"<MouseLeft>", "<MouseWheelUp>", "<MouseWheelDown>", "<up>", "<down>",
 		"j", "k", "gg", "G", "<C-d>", "<C-u>", "<C-f>", "<C-b>", "dd",
-		"m", "c", "p", "a",
+		"a", "f", "g", "I", "/", "<enter>", "w", "x", "N",
 	}
 	ui.Off(events)
+	ui.Off(procSortKeys)
 }
 
-// FieldsToStrings converts a []Process to a [][]string
-func FieldsToStrings(P []Process) [][]string {
+// FieldsToStrings converts a []Process to a [][]string, with the syscall and
+// cancelled write columns if extended is set
+func FieldsToStrings(P []Process, extended bool) [][]string {
 	strings := make([][]string, len(P))
 	for i, p := range P {
-		strings[i] = make([]string, 8)
+		strings[i] = make([]string, 12, 15)
 		strings[i][0] = strconv.Itoa(int(p.PID))
 		strings[i][1] = p.Command
-		strings[i][2] = fmt.Sprintf("%4s", strconv.FormatFloat(p.CPU, 'f', 1, 64))
-		strings[i][3] = fmt.Sprintf("%4s", strconv.FormatFloat(float64(p.Mem), 'f', 1, 32))
-		strings[i][4] = fmt.Sprintf("%6s", strconv.FormatFloat(p.OutMBps, 'f', 3, 64))
-		strings[i][5] = fmt.Sprintf("%6s", strconv.FormatFloat(p.InMBpS, 'f', 3, 64))
-		strings[i][6] = fmt.Sprintf("%6s", strconv.FormatFloat(p.WMBps, 'f', 3, 64))
-		strings[i][7] = fmt.Sprintf("%6s", strconv.FormatFloat(p.RMBps, 'f', 3, 64))
+		strings[i][2] = p.State
+		strings[i][3] = fmt.Sprintf("%4s", strconv.FormatFloat(p.CPU, 'f', 1, 64))
+		strings[i][4] = fmt.Sprintf("%4s", strconv.FormatFloat(float64(p.Mem), 'f', 1, 32))
+		strings[i][5] = fmt.Sprintf("%6s", strconv.FormatFloat(p.OutMBps, 'f', 3, 64))
+		strings[i][6] = fmt.Sprintf("%6s", strconv.FormatFloat(p.InMBpS, 'f', 3, 64))
+		strings[i][7] = fmt.Sprintf("%6s", strconv.FormatFloat(p.WMBps, 'f', 3, 64))
+		strings[i][8] = fmt.Sprintf("%6s", strconv.FormatFloat(p.RMBps, 'f', 3, 64))
+		strings[i][9] = fmt.Sprintf("%7s", strconv.FormatFloat(p.IOWait, 'f', 1, 64))
+		if p.prioMixed {
+			strings[i][10] = "  *"
+			strings[i][11] = "     *"
+		} else {
+			strings[i][10] = fmt.Sprintf("%3d", p.Nice)
+			strings[i][11] = fmt.Sprintf("%6s", utils.FormatIOPrio(p.IOClass, p.IOLevel))
+		}
+		if extended {
+			strings[i] = append(strings[i],
+				fmt.Sprintf("%7s", strconv.FormatFloat(p.RSysc, 'f', 0, 64)),
+				fmt.Sprintf("%7s", strconv.FormatFloat(p.WSysc, 'f', 0, 64)),
+				fmt.Sprintf("%11s", strconv.FormatFloat(p.CMBps, 'f', 3, 64)),
+			)
+		}
 	}
 	return strings
 }
 
-// Kill kills process or group of processes.
-func (self *Proc) Kill() {
-	self.SelectedItem = ""
-	command := "kill"
-	if self.UniqueCol == 1 {
-		command = "pkill"
+// ToggleGroup switches between a row per process and a row per command.
+func (self *Proc) ToggleGroup() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.gTimer = nil
+	self.group = !self.group
+	if self.group {
+		self.UniqueCol = 1
+	} else {
+		self.UniqueCol = 0
 	}
-	cmd := exec.Command(command, self.Rows[self.SelectedRow][self.UniqueCol])
-	cmd.Start()
+	self.setLabel()
+	self.Top()
+	self.Sort()
 }
 
-/////////////////////////////////////////////////////////////////////////////////
-//                              []Process Sorting                              //
-/////////////////////////////////////////////////////////////////////////////////
+// selected returns the selected row with the processes it stands for and a
+// description of them. Called with mu held.
+func (self *Proc) selected() (Process, []int32, string, bool) {
+	if self.SelectedRow < 0 || self.SelectedRow >= len(self.rowProcs) {
+		return Process{}, nil, "", false
+	}
+	p := self.rowProcs[self.SelectedRow]
+	if self.group {
+		pids := self.groupPids[p.Command]
+		return p, pids, fmt.Sprintf("%d %s processes", len(pids), p.Command), true
+	}
+	return p, []int32{p.PID}, fmt.Sprintf("%d %s", p.PID, p.Command), true
+}
 
-type ProcessByCPU []Process
+// Kill asks for a signal to send to the selected process, or to every
+// process of the selected group.
+func (self *Proc) Kill() {
+	self.mu.Lock()
+	if self.ReadOnly {
+		self.setStatus("read-only: signals are disabled")
+		self.mu.Unlock()
+		return
+	}
+	_, pids, target, ok := self.selected()
+	// the signal is only sent if each PID still belongs to the process shown
+	handles := make([]utils.ProcHandle, 0, len(pids))
+	for _, pid := range pids {
+		handles = append(handles, self.handles[pid])
+	}
+	self.mu.Unlock()
 
-// Len implements Sort interface
-func (P ProcessByCPU) Len() int {
-	return len(P)
+	if ok && self.Signal != nil {
+		self.Signal(handles, target)
+	}
 }
 
-// Swap implements Sort interface
-func (P ProcessByCPU) Swap(i, j int) {
-	P[i], P[j] = P[j], P[i]
-}
+// Renice asks for the nice value and I/O scheduling of the selected process,
+// or of every process of the selected group.
+func (self *Proc) Renice() {
+	self.mu.Lock()
+	if self.ReadOnly {
+		self.setStatus("read-only: priority changes are disabled")
+		self.mu.Unlock()
+		return
+	}
+	p, pids, target, ok := self.selected()
+	// the priority is only set if each PID still belongs to the process shown
+	handles := make([]utils.ProcHandle, 0, len(pids))
+	for _, pid := range pids {
+		handles = append(handles, self.handles[pid])
+	}
+	self.mu.Unlock()
 
-// Less implements Sort interface
-func (P ProcessByCPU) Less(i, j int) bool {
-	return P[i].CPU < P[j].CPU
+	if ok && self.Priority != nil {
+		self.Priority(handles, target, p.Nice, p.IOClass, p.IOLevel)
+	}
 }
 
-type ProcessByPID []Process
+// selectedPid returns the PID of the selected process. Group rows have no
+// single process.
+func (self *Proc) selectedPid() (int32, bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
 
-// Len implements Sort interface
-func (P ProcessByPID) Len() int {
-	return len(P)
+	p, _, _, ok := self.selected()
+	if self.group || !ok {
+		return 0, false
+	}
+	return p.PID, true
 }
 
-// Swap implements Sort interface
-func (P ProcessByPID) Swap(i, j int) {
-	P[i], P[j] = P[j], P[i]
+// PriorityChanged makes the next update read the I/O priorities again
+// instead of showing the ones read before they were changed.
+func (self *Proc) PriorityChanged() {
+	self.mu.Lock()
+	self.scanner.ExpireIOPrio()
+	self.mu.Unlock()
 }
 
-// Less implements Sort interface
-func (P ProcessByPID) Less(i, j int) bool {
-	return P[i].PID < P[j].PID
+// SetStatus shows the result of a signal in the label for a while.
+func (self *Proc) SetStatus(status string) {
+	self.mu.Lock()
+	self.setStatus(status)
+	self.mu.Unlock()
 }
 
-type ProcessByMem []Process
-
-// Len implements Sort interface
-func (P ProcessByMem) Len() int {
-	return len(P)
+func (self *Proc) setStatus(status string) {
+	self.status = status
+	self.statusUntil = time.Now().Add(statusTime)
+	self.setLabel()
 }
 
-// Swap implements Sort interface
-func (P ProcessByMem) Swap(i, j int) {
-	P[i], P[j] = P[j], P[i]
-}
+/////////////////////////////////////////////////////////////////////////////////
+//                              []Process Sorting                              //
+/////////////////////////////////////////////////////////////////////////////////
 
-// Less implements Sort interface
-func (P ProcessByMem) Less(i, j int) bool {
-	return P[i].Mem < P[j].Mem
+// procLess returns the ascending order of processes by a column
+func procLess(col int) func(a, b Process) bool {
+	switch col {
+	case 0:
+		return func(a, b Process) bool { return a.PID < b.PID }
+	case 1:
+		return func(a, b Process) bool { return a.Command < b.Command }
+	case 2:
+		return func(a, b Process) bool { return a.State < b.State }
+	case 3:
+		return func(a, b Process) bool { return a.CPU < b.CPU }
+	case 4:
+		return func(a, b Process) bool { return a.Mem < b.Mem }
+	case 5:
+		return func(a, b Process) bool { return a.OutMBps < b.OutMBps }
+	case 6:
+		return func(a, b Process) bool { return a.InMBpS < b.InMBpS }
+	case 7:
+		return func(a, b Process) bool { return a.WMBps < b.WMBps }
+	case 8:
+		return func(a, b Process) bool { return a.RMBps < b.RMBps }
+	case 9:
+		return func(a, b Process) bool { return a.IOWait < b.IOWait }
+	case 10:
+		return func(a, b Process) bool { return a.Nice < b.Nice }
+	case 11:
+		return func(a, b Process) bool {
+			if a.IOClass != b.IOClass {
+				return a.IOClass < b.IOClass
+			}
+			return a.IOLevel < b.IOLevel
+		}
+	case 12:
+		return func(a, b Process) bool { return a.RSysc < b.RSysc }
+	case 13:
+		return func(a, b Process) bool { return a.WSysc < b.WSysc }
+	case 14:
+		return func(a, b Process) bool { return a.CMBps < b.CMBps }
+	}
+	return func(a, b Process) bool { return false }
 }
@@ -0,0 +1,48 @@
+package widgets
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benmcclelland/vsmtop/utils"
+)
+
+func TestTrackLifecycle(t *testing.T) {
+	var events []string
+	self := &Proc{
+		exited:    make(map[procKey]time.Time),
+		Lifecycle: func(t time.Time, msg string) { events = append(events, msg) },
+	}
+	started := time.Now().Add(-time.Minute)
+	fsd := &utils.ProcStat{Pid: 10, Ppid: 1, Name: "sam-fsd", Started: started}
+	archiverd := &utils.ProcStat{Pid: 20, Ppid: 10, Name: "sam-archiverd", Started: started}
+	arcopy := func(pid int32) *utils.ProcStat {
+		return &utils.ProcStat{Pid: pid, Ppid: 20, Name: "sam-arcopy", Started: started}
+	}
+	update := func(procs ...*utils.ProcStat) []string {
+		events = nil
+		self.trackLifecycle(procs, procs)
+		return events
+	}
+
+	update(fsd, archiverd, arcopy(30))
+	// movers come and go without events
+	if got := update(fsd, archiverd, arcopy(31)); got != nil {
+		t.Errorf("arcopy churn: %q", got)
+	}
+
+	if got, want := update(fsd, arcopy(31)), []string{"sam-archiverd exited (pid 20, ran 1m0s)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("exit: got %q, want %q", got, want)
+	}
+	restarted := &utils.ProcStat{Pid: 21, Ppid: 10, Name: "sam-archiverd", Started: time.Now()}
+	if got, want := update(fsd, restarted, arcopy(31)), []string{"sam-archiverd restarted (pid 21)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("restart: got %q, want %q", got, want)
+	}
+
+	// the same command under another parent is a new daemon, not a restart
+	other := &utils.ProcStat{Pid: 40, Ppid: 1, Name: "sam-archiverd", Started: time.Now()}
+	if got, want := update(fsd, restarted, other, arcopy(31)), []string{"sam-archiverd started (pid 40)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("start: got %q, want %q", got, want)
+	}
+}
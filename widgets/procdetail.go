@@ -0,0 +1,253 @@
+package widgets
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	ui "github.com/benmcclelland/termui"
+	"github.com/benmcclelland/vsmtop/utils"
+)
+
+// ProcDetailView shows everything about one process over the other widgets,
+// or where its threads are waiting in the kernel. It refreshes every interval
+// while it is open.
+type ProcDetailView struct {
+	*ui.Block
+	interval time.Duration
+
+	pid      int32
+	stacks   bool
+	lines    []string
+	top      int
+	prevCPU  map[int32]float64 // thread CPU seconds at the last refresh
+	prevTime time.Time
+	procs    []*utils.ProcStat // the last scan of the process list
+	stop     chan bool
+	// Refreshed is sent on whenever the view has new data
+	Refreshed chan bool
+
+	mu sync.Mutex
+}
+
+func NewProcDetailView(refreshed chan bool) *ProcDetailView {
+	return &ProcDetailView{
+		Block:     ui.NewBlock(),
+		interval:  time.Second,
+		Refreshed: refreshed,
+	}
+}
+
+// Open starts showing and refreshing the detail of a process
+func (self *ProcDetailView) Open(pid int32) {
+	self.open(pid, false)
+}
+
+// OpenStacks starts showing and refreshing the wait channel and kernel stack
+// of each thread of a process
+func (self *ProcDetailView) OpenStacks(pid int32) {
+	self.open(pid, true)
+}
+
+func (self *ProcDetailView) open(pid int32, stacks bool) {
+	self.mu.Lock()
+	self.pid = pid
+	self.stacks = stacks
+	self.top = 0
+	self.prevCPU = nil
+	self.lines = []string{"reading process " + fmt.Sprint(pid)}
+	self.stop = make(chan bool)
+	stop := self.stop
+	self.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(self.interval)
+		defer ticker.Stop()
+		for {
+			self.update()
+			self.Refreshed <- true
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Scanned keeps the processes of the process list's last scan, which the
+// children of the process are found in
+func (self *ProcDetailView) Scanned(procs []*utils.ProcStat) {
+	self.mu.Lock()
+	self.procs = procs
+	self.mu.Unlock()
+}
+
+// Close stops refreshing the view
+func (self *ProcDetailView) Close() {
+	self.mu.Lock()
+	close(self.stop)
+	self.mu.Unlock()
+}
+
+func (self *ProcDetailView) update() {
+	self.mu.Lock()
+	pid := self.pid
+	stacks := self.stacks
+	procs := self.procs
+	self.mu.Unlock()
+
+	if stacks {
+		self.updateStacks(pid)
+		return
+	}
+
+	d, err := utils.GetProcDetail(utils.PROCROOT, pid, procs)
+	now := time.Now()
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if err != nil {
+		if debug {
+			log.Println(err)
+		}
+		self.Label = fmt.Sprintf("Process %d", pid)
+		self.lines = []string{"process has exited"}
+		return
+	}
+	self.Label = fmt.Sprintf("Process %d %s", pid, d.Name)
+
+	// thread CPU% is the CPU time used since the last refresh
+	cpu := make(map[int32]float64, len(d.Threads))
+	for _, t := range d.Threads {
+		cpu[t.Tid] = t.CPU
+	}
+	elapsed := now.Sub(self.prevTime).Seconds()
+	threadCPU := func(t utils.ThreadStat) string {
+		prev, ok := self.prevCPU[t.Tid]
+		if !ok || elapsed <= 0 {
+			return "   -"
+		}
+		return fmt.Sprintf("%5.1f", (t.CPU-prev)/elapsed*100)
+	}
+
+	var l []string
+	add := func(format string, a ...interface{}) {
+		l = append(l, fmt.Sprintf(format, a...))
+	}
+
+	add("cmdline:  %s", d.Cmdline)
+	add("user:     %s", d.User)
+	add("started:  %s", d.Started.Format("2006-01-02 15:04:05"))
+	add("parent:   %d %s", d.Ppid, d.ParentName)
+	var children []string
+	for _, c := range d.Children {
+		children = append(children, fmt.Sprintf("%d %s", c.Pid, c.Name))
+	}
+	add("children: %s", strings.Join(children, ", "))
+	add("read:     %s  written: %s", size(d.ReadBytes), size(d.WriteBytes))
+	add("open files: %d", d.OpenFiles)
+
+	add("")
+	add("Threads (%d)", len(d.Threads))
+	add("  %-8s %5s  %s", "TID", "CPU%", "NAME")
+	for _, t := range d.Threads {
+		add("  %-8d %s  %s", t.Tid, threadCPU(t), t.Name)
+	}
+
+	add("")
+	add("Devices (%d)", len(d.Devices))
+	for _, f := range d.Devices {
+		add("  %-5d %s", f.Fd, f.Path)
+	}
+
+	add("")
+	add("VSM files (%d)", len(d.VsmFiles))
+	for _, f := range d.VsmFiles {
+		add("  %-5d %s", f.Fd, f.Path)
+	}
+
+	add("")
+	add("Connections (%d)", len(d.Conns))
+	for _, c := range d.Conns {
+		add("  %-4s %-22s %-22s %s", c.Proto, c.Local, c.Remote, c.State)
+	}
+
+	add("")
+	add("Limits")
+	for _, limit := range d.Limits {
+		add("  %s", limit)
+	}
+
+	self.lines = l
+	self.prevCPU = cpu
+	self.prevTime = now
+}
+
+func (self *ProcDetailView) updateStacks(pid int32) {
+	threads, err := utils.GetProcStacks(utils.PROCROOT, pid)
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.Label = fmt.Sprintf("Process %d kernel stacks", pid)
+	if err != nil {
+		if debug {
+			log.Println(err)
+		}
+		self.lines = []string{"process has exited"}
+		return
+	}
+
+	var l []string
+	for _, t := range threads {
+		l = append(l, fmt.Sprintf("%d %s  state %s  wchan %s", t.Tid, t.Name, t.State, t.Wchan))
+		if os.IsPermission(t.StackErr) {
+			l = append(l, "  stack needs root")
+		} else if t.StackErr != nil {
+			l = append(l, "  stack: "+t.StackErr.Error())
+		}
+		for _, frame := range t.Stack {
+			l = append(l, "  "+frame)
+		}
+		l = append(l, "")
+	}
+	self.lines = l
+}
+
+func (self *ProcDetailView) Up() {
+	self.mu.Lock()
+	if self.top > 0 {
+		self.top--
+	}
+	self.mu.Unlock()
+}
+
+func (self *ProcDetailView) Down() {
+	self.mu.Lock()
+	if self.top < len(self.lines)-1 {
+		self.top++
+	}
+	self.mu.Unlock()
+}
+
+func (self *ProcDetailView) Buffer() *ui.Buffer {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.Block.X = ui.Body.Width - 9                         // width - 1
+	self.Block.Y = ui.Body.Height - 5                        // height - 1
+	self.Block.XOffset = (ui.Body.Width - self.Block.X) / 2  // X coordinate
+	self.Block.YOffset = (ui.Body.Height - self.Block.Y) / 2 // Y coordinate
+
+	buf := self.Block.Buffer()
+	for y := 1; y < self.Y && self.top+y-1 < len(self.lines); y++ {
+		line := ui.MaxString(self.lines[self.top+y-1], self.X-2)
+		buf.SetString(2, y, line, self.Fg, self.Bg)
+	}
+	return buf
+}
@@ -0,0 +1,382 @@
+package widgets
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// procExpr is a compiled process filter expression, such as
+// "cpu>5 && cmd~arfind" or "tx>10 || !sam-". A word without an operator
+// matches the command or the full command line, as a regexp if it is one and
+// as a substring otherwise.
+type procExpr interface {
+	match(p *Process) bool
+	// cmdline returns true if the expression needs the full command line
+	cmdline() bool
+}
+
+// comparison operators, longest first so that >= is found before >
+var procExprOps = []string{">=", "<=", "!=", "==", "!~", ">", "<", "=", "~"}
+
+type andExpr []procExpr
+type orExpr []procExpr
+type notExpr struct{ procExpr }
+
+func (self andExpr) match(p *Process) bool {
+	for _, e := range self {
+		if !e.match(p) {
+			return false
+		}
+	}
+	return true
+}
+
+func (self andExpr) cmdline() bool {
+	for _, e := range self {
+		if e.cmdline() {
+			return true
+		}
+	}
+	return false
+}
+
+func (self orExpr) match(p *Process) bool {
+	for _, e := range self {
+		if e.match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self orExpr) cmdline() bool {
+	return andExpr(self).cmdline()
+}
+
+func (self notExpr) match(p *Process) bool {
+	return !self.procExpr.match(p)
+}
+
+// wordExpr matches the command or command line
+type wordExpr struct {
+	rxp *regexp.Regexp
+}
+
+func (self wordExpr) match(p *Process) bool {
+	return self.rxp.MatchString(p.Command) || self.rxp.MatchString(p.Cmdline)
+}
+
+func (self wordExpr) cmdline() bool {
+	return true
+}
+
+// cmpExpr compares a column of a process with a value
+type cmpExpr struct {
+	field string
+	op    string
+	text  bool // cmd, cmdline and state compare as strings
+	num   float64
+	str   string
+	rxp   *regexp.Regexp
+}
+
+func (self cmpExpr) match(p *Process) bool {
+	var s string
+	var n float64
+	switch self.field {
+	case "cmd":
+		s = p.Command
+	case "cmdline":
+		s = p.Cmdline
+	case "state":
+		s = p.State
+	case "pid":
+		n = float64(p.PID)
+	case "cpu":
+		n = p.CPU
+	case "mem":
+		n = float64(p.Mem)
+	case "tx":
+		n = p.OutMBps
+	case "rx":
+		n = p.InMBpS
+	case "w":
+		n = p.WMBps
+	case "r":
+		n = p.RMBps
+	case "iowait":
+		n = p.IOWait
+	case "nice":
+		n = float64(p.Nice)
+	}
+
+	switch self.op {
+	case "~":
+		return self.rxp.MatchString(s)
+	case "!~":
+		return !self.rxp.MatchString(s)
+	}
+	if self.text {
+		switch self.op {
+		case "==", "=":
+			return s == self.str
+		case "!=":
+			return s != self.str
+		}
+		return false
+	}
+	switch self.op {
+	case ">":
+		return n > self.num
+	case "<":
+		return n < self.num
+	case ">=":
+		return n >= self.num
+	case "<=":
+		return n <= self.num
+	case "==", "=":
+		return n == self.num
+	case "!=":
+		return n != self.num
+	}
+	return false
+}
+
+func (self cmpExpr) cmdline() bool {
+	return self.field == "cmdline"
+}
+
+// parseProcExpr compiles a filter expression. && binds tighter than ||,
+// ! negates and parentheses group.
+func parseProcExpr(s string) (procExpr, error) {
+	tokens, err := tokenizeProcExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	if len(p.tokens) == 0 {
+		return nil, nil
+	}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+// tokenizeProcExpr splits an expression into words, &&, ||, !, ( and ).
+// Parentheses opened within a word are part of it, so a regexp such as
+// cmd~(arfind|sam-) is a single word, and a ) only closes a group if one is
+// open. Double quotes keep spaces and operators in a word. A comparison
+// written with spaces, such as "cpu > 5", is joined into a single word.
+func tokenizeProcExpr(s string) ([]string, error) {
+	var tokens []string
+	var word []byte
+	inWord := false
+	nested := 0 // parentheses open within the word
+	groups := 0 // parentheses open around words
+	end := func() {
+		if inWord {
+			tokens = append(tokens, string(word))
+		}
+		word, inWord, nested = word[:0], false, 0
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			j := strings.IndexByte(s[i+1:], '"')
+			if j < 0 {
+				return nil, fmt.Errorf("missing closing quote")
+			}
+			word = append(word, s[i+1:i+1+j]...)
+			inWord = true
+			i += j + 1
+			continue
+		case nested == 0 && (strings.HasPrefix(s[i:], "&&") || strings.HasPrefix(s[i:], "||")):
+			end()
+			tokens = append(tokens, s[i:i+2])
+			i++
+			continue
+		case c == ' ' || c == '\t':
+			end()
+			continue
+		case !inWord && c == '(':
+			tokens = append(tokens, "(")
+			groups++
+			continue
+		case !inWord && c == '!' && !strings.HasPrefix(s[i:], "!=") && !strings.HasPrefix(s[i:], "!~"):
+			tokens = append(tokens, "!")
+			continue
+		case c == ')' && nested == 0 && groups > 0:
+			end()
+			tokens = append(tokens, ")")
+			groups--
+			continue
+		case c == '(':
+			nested++
+		case c == ')' && nested > 0:
+			nested--
+		}
+		word = append(word, c)
+		inWord = true
+	}
+	end()
+
+	var joined []string
+	for i := 0; i < len(tokens); i++ {
+		if isOp(tokens[i]) && len(joined) > 0 && i+1 < len(tokens) {
+			joined[len(joined)-1] += tokens[i] + tokens[i+1]
+			i++
+			continue
+		}
+		joined = append(joined, tokens[i])
+	}
+	return joined, nil
+}
+
+func isOp(s string) bool {
+	for _, op := range procExprOps {
+		if s == op {
+			return true
+		}
+	}
+	return false
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func (self *exprParser) next() string {
+	if self.pos < len(self.tokens) {
+		return self.tokens[self.pos]
+	}
+	return ""
+}
+
+func (self *exprParser) or() (procExpr, error) {
+	var exprs orExpr
+	for {
+		e, err := self.and()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+		if self.next() != "||" {
+			break
+		}
+		self.pos++
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return exprs, nil
+}
+
+// and also joins terms written next to each other, so "sam- cpu>1" is
+// the same as "sam- && cpu>1"
+func (self *exprParser) and() (procExpr, error) {
+	var exprs andExpr
+	for {
+		e, err := self.term()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+		if tok := self.next(); tok == "&&" {
+			self.pos++
+		} else if tok == "" || tok == "||" || tok == ")" {
+			break
+		}
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return exprs, nil
+}
+
+func (self *exprParser) term() (procExpr, error) {
+	tok := self.next()
+	switch tok {
+	case "":
+		return nil, fmt.Errorf("unexpected end")
+	case "!":
+		self.pos++
+		e, err := self.term()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{e}, nil
+	case "(":
+		self.pos++
+		e, err := self.or()
+		if err != nil {
+			return nil, err
+		}
+		if self.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		self.pos++
+		return e, nil
+	case ")", "&&", "||":
+		return nil, fmt.Errorf("unexpected %q", tok)
+	}
+	self.pos++
+	return parseProcTerm(tok)
+}
+
+var procExprFields = map[string]bool{
+	"cmd": true, "cmdline": true, "state": true, "pid": true, "cpu": true, "mem": true,
+	"tx": true, "rx": true, "w": true, "r": true, "iowait": true,
+	"nice": true,
+}
+
+func parseProcTerm(tok string) (procExpr, error) {
+	for _, op := range procExprOps {
+		i := strings.Index(tok, op)
+		if i <= 0 || !procExprFields[tok[:i]] {
+			continue
+		}
+		e := cmpExpr{field: tok[:i], op: op}
+		value := tok[i+len(op):]
+		e.text = e.field == "cmd" || e.field == "cmdline" || e.field == "state"
+		switch {
+		case op == "~" || op == "!~":
+			if !e.text {
+				return nil, fmt.Errorf("%s only works on cmd, cmdline and state", op)
+			}
+			// like a word, a value that isn't a regexp matches as it is
+			rxp, err := regexp.Compile(value)
+			if err != nil {
+				rxp = regexp.MustCompile(regexp.QuoteMeta(value))
+			}
+			e.rxp = rxp
+		case e.text:
+			if op != "==" && op != "=" && op != "!=" {
+				return nil, fmt.Errorf("%s doesn't work on %s", op, e.field)
+			}
+			e.str = value
+		default:
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s needs a number", e.field)
+			}
+			e.num = n
+		}
+		return e, nil
+	}
+
+	rxp, err := regexp.Compile(tok)
+	if err != nil {
+		rxp = regexp.MustCompile(regexp.QuoteMeta(tok))
+	}
+	return wordExpr{rxp}, nil
+}
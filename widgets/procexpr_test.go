@@ -0,0 +1,117 @@
+package widgets
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenizeProcExpr(t *testing.T) {
+	tests := []struct {
+		expr   string
+		tokens []string
+	}{
+		{"cpu>5 && cmd~arfind", []string{"cpu>5", "&&", "cmd~arfind"}},
+		{"cpu > 5", []string{"cpu>5"}},
+		{"cmd != sam-fsd", []string{"cmd!=sam-fsd"}},
+		{"a&&b||c", []string{"a", "&&", "b", "||", "c"}},
+		{"!sam-", []string{"!", "sam-"}},
+		{"!(a || b)", []string{"!", "(", "a", "||", "b", ")"}},
+		{"((cpu>1))", []string{"(", "(", "cpu>1", ")", ")"}},
+		{"cmd~(a|b)", []string{"cmd~(a|b)"}},
+		{"(cmd~(a|b))", []string{"(", "cmd~(a|b)", ")"}},
+		{"cmd~foo)", []string{"cmd~foo)"}},
+		{"cmd~(a||b)", []string{"cmd~(a||b)"}},
+		{`cmdline~"-c /etc" cpu>1`, []string{"cmdline~-c /etc", "cpu>1"}},
+		{`cmd~"a && (b"`, []string{"cmd~a && (b"}},
+	}
+
+	for _, tt := range tests {
+		tokens, err := tokenizeProcExpr(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(tokens, tt.tokens) {
+			t.Errorf("%q: got %q, want %q", tt.expr, tokens, tt.tokens)
+		}
+	}
+}
+
+func TestParseProcExpr(t *testing.T) {
+	procs := map[string]*Process{
+		"fsd":     {PID: 10, Command: "sam-fsd", State: "S", CPU: 1},
+		"arfind":  {PID: 20, Command: "sam-arfind", State: "D", CPU: 12, WMBps: 40},
+		"rsync":   {PID: 30, Command: "rsync", Cmdline: "rsync -a /sam1 host:", State: "R", CPU: 60, OutMBps: 15},
+		"paren":   {PID: 40, Command: "foo)", State: "S"},
+		"cleaner": {PID: 50, Command: "cleaner", Cmdline: "cleaner -c /etc/opt/vsm", State: "S", Nice: 10},
+	}
+
+	tests := []struct {
+		expr  string
+		match []string
+	}{
+		{"sam-", []string{"fsd", "arfind"}},
+		{"cpu>5", []string{"arfind", "rsync"}},
+		{"cpu >= 12", []string{"arfind", "rsync"}},
+		{"state==D", []string{"arfind"}},
+		{"nice>0", []string{"cleaner"}},
+		{"!sam-", []string{"rsync", "paren", "cleaner"}},
+		// && binds tighter than ||
+		{"state==S || cpu>5 && w>0", []string{"fsd", "arfind", "paren", "cleaner"}},
+		{"(state==S || cpu>5) && w>0", []string{"arfind"}},
+		{"sam- cpu>5", []string{"arfind"}},
+		{"!(sam- || rsync)", []string{"paren", "cleaner"}},
+		{"!(!(cpu>5) && !(tx>10))", []string{"arfind", "rsync"}},
+		{"((pid<25))", []string{"fsd", "arfind"}},
+		{"cmd~^sam-(fsd|arfind)$", []string{"fsd", "arfind"}},
+		{"(cmd~(fsd|rsync))", []string{"fsd", "rsync"}},
+		{"cmd!~(sam|rs)", []string{"paren", "cleaner"}},
+		{"cmd~foo)", []string{"paren"}},
+		{"cmdline~/sam1", []string{"rsync"}},
+		{`cmdline~"-c /etc"`, []string{"cleaner"}},
+	}
+
+	for _, tt := range tests {
+		e, err := parseProcExpr(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		var match []string
+		for _, name := range []string{"fsd", "arfind", "rsync", "paren", "cleaner"} {
+			if e.match(procs[name]) {
+				match = append(match, name)
+			}
+		}
+		if !reflect.DeepEqual(match, tt.match) {
+			t.Errorf("%q: matched %v, want %v", tt.expr, match, tt.match)
+		}
+	}
+}
+
+func TestParseProcExprErrors(t *testing.T) {
+	for _, expr := range []string{
+		"(cpu>5",
+		"cpu>5)",
+		"cpu>5 &&",
+		"&& cpu>5",
+		"cpu>5 || || mem>1",
+		"()",
+		"!",
+		"cpu>fast",
+		"cpu~5",
+		"state>D",
+		`cmd~"sam`,
+	} {
+		if _, err := parseProcExpr(expr); err == nil {
+			t.Errorf("%q: no error", expr)
+		}
+	}
+}
+
+func TestParseProcExprEmpty(t *testing.T) {
+	e, err := parseProcExpr("  ")
+	if e != nil || err != nil {
+		t.Errorf("got %v, %v for an empty expression", e, err)
+	}
+}
@@ -0,0 +1,128 @@
+package widgets
+
+import (
+	"fmt"
+	"syscall"
+
+	ui "github.com/benmcclelland/termui"
+	"github.com/benmcclelland/vsmtop/utils"
+)
+
+var signals = []struct {
+	name string
+	sig  syscall.Signal
+}{
+	{"TERM", syscall.SIGTERM},
+	{"KILL", syscall.SIGKILL},
+	{"HUP", syscall.SIGHUP},
+	{"USR1", syscall.SIGUSR1},
+	{"STOP", syscall.SIGSTOP},
+	{"CONT", syscall.SIGCONT},
+}
+
+// SignalMenu is a dialog for choosing the signal to send to a process or a
+// group of processes.
+type SignalMenu struct {
+	*ui.Block
+	procs    []utils.ProcHandle
+	target   string
+	selected int
+	Cursor   ui.Color
+}
+
+func NewSignalMenu() *SignalMenu {
+	block := ui.NewBlock()
+	block.Label = "Send Signal"
+	block.X = 48 // width - 1
+	block.Y = len(signals) + 5
+	return &SignalMenu{
+		Block:  block,
+		Cursor: ui.Theme.TableCursor,
+	}
+}
+
+// Open sets the processes the signal will be sent to, with target
+// describing them, and selects TERM.
+func (self *SignalMenu) Open(procs []utils.ProcHandle, target string) {
+	self.procs = procs
+	self.target = target
+	self.selected = 0
+}
+
+func (self *SignalMenu) Up() {
+	if self.selected > 0 {
+		self.selected--
+	}
+}
+
+func (self *SignalMenu) Down() {
+	if self.selected < len(signals)-1 {
+		self.selected++
+	}
+}
+
+// Send sends the selected signal to each process and returns a status line
+// with the result. Processes whose PID has been reused since they were
+// scanned are skipped.
+func (self *SignalMenu) Send() string {
+	s := signals[self.selected]
+	var sent, skipped int
+	var firstErr error
+	for _, p := range self.procs {
+		err := p.Signal(s.sig)
+		switch {
+		case err == utils.ErrPidReused:
+			skipped++
+		case err != nil:
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%d: %v", p.Pid, err)
+			}
+		default:
+			sent++
+		}
+	}
+
+	if len(self.procs) == 1 {
+		switch {
+		case skipped > 0:
+			return fmt.Sprintf("%s %s not sent: %v", s.name, self.target, utils.ErrPidReused)
+		case firstErr != nil:
+			return fmt.Sprintf("%s %s failed: %v", s.name, self.target, firstErr)
+		}
+	}
+	if sent == len(self.procs) {
+		return fmt.Sprintf("sent %s to %s", s.name, self.target)
+	}
+	status := fmt.Sprintf("sent %s to %d/%d of %s", s.name, sent, len(self.procs), self.target)
+	if skipped > 0 {
+		status += fmt.Sprintf(", %d skipped as reused PIDs", skipped)
+	}
+	if firstErr != nil {
+		status += fmt.Sprintf(", %v", firstErr)
+	}
+	return status
+}
+
+func (self *SignalMenu) Buffer() *ui.Buffer {
+	buf := self.Block.Buffer()
+
+	self.Block.XOffset = (ui.Body.Width - self.Block.X) / 2  // X coordinate
+	self.Block.YOffset = (ui.Body.Height - self.Block.Y) / 2 // Y coordinate
+
+	target := self.target
+	if len(target) > self.X-2 {
+		target = target[:self.X-2]
+	}
+	buf.SetString(2, 1, target, self.Fg, self.Bg)
+	for i, s := range signals {
+		fg, bg := self.Fg, self.Bg
+		if i == self.selected {
+			bg = self.Cursor
+		}
+		line := fmt.Sprintf("%-4s %2d", s.name, int(s.sig))
+		buf.SetString(4, i+3, line, fg, bg)
+	}
+	buf.SetString(2, self.Y-1, "<enter> send, <escape> cancel", self.Fg, self.Bg)
+
+	return buf
+}
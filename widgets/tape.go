@@ -3,21 +3,37 @@ package widgets
 import (
 	"fmt"
 	"log"
+	"sort"
+	"sync"
 	"time"
 
 	ui "github.com/benmcclelland/termui"
 	"github.com/benmcclelland/vsmtop/utils"
 )
 
+var tapeHeader = []string{"DEV", "Wbps", "Rbps", "UTIL%"}
+
 type Tape struct {
 	*ui.Table
 	interval time.Duration
 
 	devs         []string
+	changers     []utils.Changer
+	expanded     map[string]bool
+	rowKeys      []string
+	rowColors    map[int]ui.Color
 	KeyPressed   chan bool
+	AlertColor   ui.Color
 	countersprev map[string]utils.TapeStats
 	countersnew  map[string]utils.TapeStats
+	scsiprev     map[string]utils.ScsiCounters
+	scsinew      map[string]utils.ScsiCounters
+	lastErr      map[string]time.Time
+	sort         tableSort
 	none         bool
+
+	// synchronize simultaneous updates due to user keypressed
+	mu sync.Mutex
 }
 
 func NewTape(keyPressed chan bool) *Tape {
@@ -26,19 +42,26 @@ func NewTape(keyPressed chan bool) *Tape {
 	if err != nil {
 		none = true
 	}
+	// drives are grouped by library when there are changers to group them by
+	changers, _ := utils.FindChangers()
 
 	self := &Tape{
 		Table:      ui.NewTable(),
 		interval:   time.Second,
 		devs:       devs,
+		changers:   changers,
+		expanded:   make(map[string]bool),
 		KeyPressed: keyPressed,
+		AlertColor: ui.Theme.Fg,
+		lastErr:    make(map[string]time.Time),
+		sort:       tableSort{col: -1},
 		none:       none,
 	}
 	self.Label = "Tape Drive Usage"
 	self.ColResizer = self.ColResize
 	self.ColWidths = []int{6, 10, 10, 12}
 	self.UniqueCol = 0
-	self.Header = []string{"DEV", "Wbps", "Rbps", "UTIL%"}
+	self.setHeader()
 	self.SelectedRow = -1
 
 	self.update()
@@ -54,14 +77,16 @@ func NewTape(keyPressed chan bool) *Tape {
 }
 
 func (self *Tape) update() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
 	if self.none {
 		self.Rows = make([][]string, 1)
 		self.Rows[0] = []string{"None", "", "", ""}
 		return
 	}
 
-	var err error
-	self.countersnew, err = utils.GetAllStats(self.devs)
+	counters, err := utils.GetAllStats(self.devs)
 	if err != nil {
 		if debug {
 			log.Println(err)
@@ -69,20 +94,175 @@ func (self *Tape) update() {
 		return
 	}
 
+	scsi := make(map[string]utils.ScsiCounters, len(self.devs))
+	for _, dev := range self.devs {
+		c, err := utils.TapeScsiCounters(dev)
+		if err != nil {
+			if debug {
+				log.Println(err)
+			}
+			continue
+		}
+		scsi[dev] = c
+	}
+
+	self.countersprev, self.countersnew = self.countersnew, counters
+	self.scsiprev, self.scsinew = self.scsinew, scsi
+
 	if self.countersprev == nil {
-		self.countersprev = self.countersnew
 		return
 	}
 
-	self.Rows = make([][]string, len(self.devs))
-	for i, dev := range self.devs {
-		self.Rows[i] = self.updateDev(dev, i)
+	// scsi errors and residual counts both mean the drive had a problem
+	now := time.Now()
+	for _, dev := range self.devs {
+		if self.countersnew[dev]["resid_cnt"] > self.countersprev[dev]["resid_cnt"] {
+			self.lastErr[dev] = now
+		}
+		prev, ok := self.scsiprev[dev]
+		if ok && self.scsinew[dev].IoErr > prev.IoErr {
+			self.lastErr[dev] = now
+		}
+	}
+
+	self.updateRows()
+}
+
+// updateRows rebuilds the table from the last two sets of counters
+func (self *Tape) updateRows() {
+	self.Rows = nil
+	self.rowKeys = nil
+	self.rowColors = make(map[int]ui.Color)
+
+	if len(self.changers) == 0 {
+		for _, dev := range self.sortDevs(self.devs) {
+			self.addDev(dev, dev)
+		}
+		return
+	}
+
+	grouped := make(map[string]bool)
+	for _, c := range self.changers {
+		self.addRow([]string{c.Name, "", "", ""}, "")
+		for _, dev := range self.sortDevs(c.Drives) {
+			self.addDev("  "+dev, dev)
+			grouped[dev] = true
+		}
+	}
+	// drives that couldn't be tied to a single library
+	var unassigned []string
+	for _, dev := range self.devs {
+		if !grouped[dev] {
+			unassigned = append(unassigned, dev)
+		}
+	}
+	if len(unassigned) > 0 {
+		self.addRow([]string{"unassigned", "", "", ""}, "")
+		for _, dev := range self.sortDevs(unassigned) {
+			self.addDev("  "+dev, dev)
+		}
+	}
+}
+
+// sortDevs returns the drives in the sort order. Names sort alphabetically
+// and the other columns start with the busiest drive.
+func (self *Tape) sortDevs(devs []string) []string {
+	sorted := append([]string{}, devs...)
+	if self.sort.col < 0 {
+		return sorted
+	}
+
+	desc := self.sort.descending(self.sort.col > 0)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if desc {
+			a, b = b, a
+		}
+		if self.sort.col == 0 {
+			return a < b
+		}
+		return self.value(a, self.sort.col) < self.value(b, self.sort.col)
+	})
+	return sorted
+}
+
+// value returns the number shown in a column of a drive's row
+func (self *Tape) value(dev string, col int) int64 {
+	stat := map[int]string{1: "write_byte_cnt", 2: "read_byte_cnt", 3: "io_ns"}[col]
+	return self.countersnew[dev][stat] - self.countersprev[dev][stat]
+}
+
+func (self *Tape) setHeader() {
+	self.Header = append([]string{}, tapeHeader...)
+	self.sort.marker(self.Header, self.sort.descending(self.sort.col > 0))
+}
+
+// SortBy sorts the drives in each library by a column, reversing the order
+// if they are already sorted by that column.
+func (self *Tape) SortBy(col int) {
+	self.mu.Lock()
+	self.sort.click(col)
+	self.setHeader()
+	if self.countersprev != nil && !self.none {
+		self.updateRows()
+	}
+	self.mu.Unlock()
+}
+
+func (self *Tape) addRow(row []string, key string) {
+	self.Rows = append(self.Rows, row)
+	self.rowKeys = append(self.rowKeys, key)
+}
+
+// addDev adds the row for a drive, followed by its error counters if expanded
+func (self *Tape) addDev(name, dev string) {
+	if t, ok := self.lastErr[dev]; ok && time.Since(t) < errHighlight {
+		self.rowColors[len(self.Rows)] = self.AlertColor
+	}
+	self.addRow(self.updateDev(name, dev), dev)
+
+	if !self.expanded[dev] {
+		return
+	}
+	detail := fmt.Sprintf("%s  resid %d", name, self.countersnew[dev]["resid_cnt"])
+	if c, ok := self.scsinew[dev]; ok {
+		detail += fmt.Sprintf(" ioerr %d iodone %d ioreq %d blocked %d",
+			c.IoErr, c.IoDone, c.IoRequest, c.Blocked)
+	}
+	self.addRow([]string{detail, "", "", ""}, dev+"/detail")
+}
+
+// Toggle shows or hides the error counters of the selected drive.
+func (self *Tape) Toggle() {
+	self.mu.Lock()
+	if self.SelectedRow >= 0 && self.SelectedRow < len(self.rowKeys) {
+		key := self.rowKeys[self.SelectedRow]
+		if key != "" {
+			self.expanded[key] = !self.expanded[key]
+		}
+	}
+	if self.countersprev != nil && !self.none {
+		self.updateRows()
 	}
+	self.mu.Unlock()
+}
+
+// Select moves the cursor to the given drive. It returns false if the drive
+// isn't in the table.
+func (self *Tape) Select(dev string) bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
 
-	self.countersprev = self.countersnew
+	for i, key := range self.rowKeys {
+		if key == dev {
+			selectRow(self.Table, i)
+			return true
+		}
+	}
+	return false
 }
 
-func (self *Tape) updateDev(dev string, i int) []string {
+func (self *Tape) updateDev(name, dev string) []string {
 	s := make([]string, 4)
 
 	diff := self.countersnew[dev]["io_ns"] - self.countersprev[dev]["io_ns"]
@@ -90,7 +270,7 @@ func (self *Tape) updateDev(dev string, i int) []string {
 	wbps := rate(uint64(self.countersprev[dev]["write_byte_cnt"]), uint64(self.countersnew[dev]["write_byte_cnt"]), true)
 	rbps := rate(uint64(self.countersprev[dev]["read_byte_cnt"]), uint64(self.countersnew[dev]["read_byte_cnt"]), true)
 
-	s[0] = dev
+	s[0] = name
 	s[1] = wbps
 	s[2] = rbps
 	s[3] = fmt.Sprintf("%v", util)
@@ -98,9 +278,23 @@ func (self *Tape) updateDev(dev string, i int) []string {
 	return s
 }
 
+// Buffer implements the Bufferer interface and highlights drives with new errors.
+func (self *Tape) Buffer() *ui.Buffer {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	buf := self.Table.Buffer()
+	colorRows(self.Table, buf, self.rowColors)
+	return buf
+}
+
 func (self *Tape) ForeGround() {
 	ui.On("<MouseLeft>", func(e ui.Event) {
-		self.Click(e.MouseX, e.MouseY)
+		if col := headerColumn(self.Table, e.MouseX, e.MouseY); col >= 0 {
+			self.SortBy(col)
+		} else {
+			self.Click(e.MouseX, e.MouseY)
+		}
 		self.KeyPressed <- true
 	})
 
@@ -146,12 +340,18 @@ func (self *Tape) ForeGround() {
 		}
 		self.KeyPressed <- true
 	})
+
+	ui.On("<enter>", "<space>", func(e ui.Event) {
+		self.Toggle()
+		self.KeyPressed <- true
+	})
 }
 
 func (self *Tape) BackGround() {
 	events := []string{
 		"<MouseLeft>", "<MouseWheelUp>", "<MouseWheelDown>", "<up>", "<down>",
 		"j", "k", "gg", "G", "<C-d>", "<C-u>", "<C-f>", "<C-b>",
+		"<enter>", "<space>",
 	}
 	ui.Off(events)
 }